@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+	"github.com/knqyf263/boltwiz/modules/database/repository"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy <db>",
+	Short: "Copy a bucket subtree",
+	Long: `Copy the content of a bucket, with its nested buckets and sequences, into
+another bucket of the same file or of another bolt file`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// A copy into another file only reads the source, so it can run
+		// while the source is served or open elsewhere.
+		readOnly := false
+		if copyInput.destPath != "" {
+			same, err := sameFile(args[0], copyInput.destPath)
+			if err != nil {
+				return err
+			}
+			if same {
+				return xerrors.Errorf("--dest %s is the source file, leave it empty to copy within %s", copyInput.destPath, args[0])
+			}
+			readOnly = true
+		}
+
+		repo, err := repository.NewRepository(args[0], repository.Options{LockTimeout: lockTimeout, ReadOnly: readOnly})
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		result, err := repo.Copy(model.ItemToCopy{
+			LevelStack:    splitLevelStack(copyInput.from),
+			Encoding:      model.Encoding(copyInput.encoding),
+			NewLevelStack: splitLevelStack(copyInput.to),
+			DestPath:      copyInput.destPath,
+			OnConflict:    model.ConflictPolicy(copyInput.onConflict),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Copied %d buckets and %d pairs (%d skipped, %d overwritten)\n",
+			result.Buckets, result.Pairs, result.Skipped, result.Overwritten)
+		return nil
+	},
+}
+
+var copyInput = new(struct {
+	from       string
+	to         string
+	destPath   string
+	onConflict string
+	encoding   string
+})
+
+func init() {
+	copyCmd.Flags().StringVar(&copyInput.from, "from", "", "Level stack of the bucket to copy, separated by '/' (e.g. 'tenants/acme'), the whole file if empty")
+	copyCmd.Flags().StringVar(&copyInput.to, "to", "", "Level stack of the destination bucket, created if missing, the root if empty")
+	copyCmd.Flags().StringVar(&copyInput.destPath, "dest", "", "Bolt file to copy into, the source file if empty")
+	copyCmd.Flags().StringVar(&copyInput.onConflict, "on-conflict", string(model.ConflictFail), "What to do with existing keys (fail, skip or overwrite)")
+	copyCmd.Flags().StringVar(&copyInput.encoding, "encoding", string(model.EncodingUTF8), "Encoding of the level stack segments (utf8, hex or base64)")
+	rootCmd.AddCommand(copyCmd)
+}
+
+// splitLevelStack splits a '/' separated level stack. An empty string is
+// the root.
+func splitLevelStack(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+// sameFile reports whether dest is the file at src, through symlinks or
+// hard links. A dest that does not exist yet is another file.
+func sameFile(src, dest string) (bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	destInfo, err := os.Stat(dest)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return os.SameFile(srcInfo, destInfo), nil
+}
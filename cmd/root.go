@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/lmittmann/tint"
@@ -38,23 +39,61 @@ var rootCmd = &cobra.Command{
 			}()
 		}
 
+		protoMappings := input.protoMappings
+		if input.protoMapFile != "" {
+			fileMappings, err := readConfigLines(input.protoMapFile)
+			if err != nil {
+				return err
+			}
+			protoMappings = append(protoMappings, fileMappings...)
+		}
+
 		return server.StartServer(server.Options{
-			DBPath:     dbPath,
-			Port:       input.port,
-			ProtoFiles: input.protoFiles,
-			ProtoType:  input.protoType,
+			DBPath:              dbPath,
+			Port:                input.port,
+			ProtoFiles:          input.protoFiles,
+			ProtoType:           input.protoType,
+			ProtoMappings:       protoMappings,
+			ImportPaths:         input.importPaths,
+			Protosets:           input.protosets,
+			ProtoWire:           input.protoWire,
+			CodecMappings:       input.codecMappings,
+			CompressionMappings: input.compressionMappings,
+			EncryptionKeyFile:   input.encryptionKeyFile,
+			EncryptionNonce:     input.encryptionNonce,
+			EncryptionPatterns:  input.encryptionPatterns,
+			KeyMappings:         input.keyMappings,
+			ReadOnly:            input.readOnly,
+			LockTimeout:         lockTimeout,
+			Snapshot:            input.snapshot,
 		})
 	},
 }
 
 var input = new(struct {
-	debug      bool
-	local      bool
-	port       int
-	protoType  string
-	protoFiles []string
+	debug               bool
+	local               bool
+	port                int
+	protoType           string
+	protoFiles          []string
+	protoMappings       []string
+	protoMapFile        string
+	importPaths         []string
+	protosets           []string
+	protoWire           bool
+	codecMappings       []string
+	compressionMappings []string
+	encryptionKeyFile   string
+	encryptionNonce     string
+	encryptionPatterns  []string
+	keyMappings         []string
+	readOnly            bool
+	snapshot            bool
 })
 
+// lockTimeout is shared by the commands opening a database.
+var lockTimeout time.Duration
+
 func init() {
 	// set global logger
 	slog.SetDefault(slog.New(tint.NewHandler(os.Stderr, nil)))
@@ -64,6 +103,38 @@ func init() {
 	rootCmd.Flags().IntVarP(&input.port, "port", "p", 8090, "port to serve the server")
 	rootCmd.Flags().StringVar(&input.protoType, "proto-type", "", "The full type name of the message within the input (e.g. acme.weather.v1.Units)")
 	rootCmd.Flags().StringSliceVar(&input.protoFiles, "proto-files", nil, "Proto files")
+	rootCmd.Flags().StringSliceVar(&input.importPaths, "proto-import-path", nil, "Directories to resolve proto files and their imports against")
+	rootCmd.Flags().StringSliceVar(&input.protosets, "protoset", nil, "Compiled FileDescriptorSet files (e.g. from 'buf build -o' or 'protoc -o')")
+	rootCmd.Flags().BoolVar(&input.protoWire, "proto-wire", false, "Decode values without a proto type as protobuf wire format, without a schema")
+	rootCmd.Flags().StringArrayVar(&input.protoMappings, "proto-map", nil, "Bucket pattern to message type mapping, can be repeated (e.g. 'tenants/*/users=acme.User')")
+	rootCmd.Flags().StringArrayVar(&input.codecMappings, "codec-map", nil, "Bucket pattern to value codec mapping, can be repeated (e.g. 'events/**=protowire', 'cache=auto')")
+	rootCmd.Flags().StringArrayVar(&input.compressionMappings, "compression-map", nil, "Bucket pattern to compression mapping, can be repeated (gzip, zstd, snappy, snappy-framed, lz4, none or auto)")
+	rootCmd.Flags().StringVar(&input.encryptionKeyFile, "encryption-key-file", "", "AES key file (raw, hex or base64) of the AES-GCM encrypted values")
+	rootCmd.Flags().StringVar(&input.encryptionNonce, "encryption-nonce", "prefix", "Where encrypted values keep their 12-byte nonce (prefix or suffix)")
+	rootCmd.Flags().StringArrayVar(&input.encryptionPatterns, "encryption-map", nil, "Bucket pattern whose values are encrypted, can be repeated (e.g. 'secrets/**')")
+	rootCmd.Flags().StringArrayVar(&input.keyMappings, "key-map", nil, "Bucket pattern to key decoder mapping, can be repeated (uint64be, uint64le, int64, time, uuid, hex or tuple)")
+	rootCmd.Flags().BoolVar(&input.readOnly, "read-only", false, "Open the database read-only, next to other readers, and reject every change")
+	rootCmd.Flags().BoolVar(&input.snapshot, "snapshot", false, "Browse a read-only copy of the database, for databases locked by a running process")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 5*time.Second, "How long to wait for the database lock held by another process (0 waits forever)")
+	rootCmd.Flags().StringVar(&input.protoMapFile, "proto-map-file", "", "File with one '<bucket pattern>=<message type>' mapping per line")
+}
+
+// readConfigLines returns the non-empty lines of a config file, skipping
+// comments starting with '#'.
+func readConfigLines(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
 }
 
 func Execute() error {
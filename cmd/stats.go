@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+	"github.com/knqyf263/boltwiz/modules/database/repository"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <db>",
+	Short: "Show where the space of a bolt file goes",
+	Long: `Show the freelist and transaction counters of a bolt file, and the pages
+used by a bucket and by each of its child buckets, nested buckets included`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := repository.NewRepository(args[0], repository.Options{LockTimeout: lockTimeout, ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		stats, err := repo.Stats(model.StatsReqBody{
+			LevelStack: splitLevelStack(statsInput.bucket),
+			Encoding:   model.Encoding(statsInput.encoding),
+		})
+		if err != nil {
+			return err
+		}
+		if statsInput.json {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stats)
+		}
+		printStats(stats)
+		return nil
+	},
+}
+
+var statsInput = new(struct {
+	bucket   string
+	encoding string
+	json     bool
+})
+
+func init() {
+	statsCmd.Flags().StringVar(&statsInput.bucket, "bucket", "", "Level stack of the bucket, separated by '/' (e.g. 'tenants/acme'), all the buckets if empty")
+	statsCmd.Flags().StringVar(&statsInput.encoding, "encoding", string(model.EncodingUTF8), "Encoding of the level stack segments (utf8, hex or base64)")
+	statsCmd.Flags().BoolVar(&statsInput.json, "json", false, "Print the statistics as JSON")
+	rootCmd.AddCommand(statsCmd)
+}
+
+func printStats(stats model.Stats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "File size\t%s\n", formatBytes(stats.FileSize))
+	fmt.Fprintf(w, "Data size\t%s (tx %d)\n", formatBytes(stats.Size), stats.TxID)
+	fmt.Fprintf(w, "Page size\t%d\n", stats.PageSize)
+	// FreeAlloc is only computed when a write transaction commits.
+	fmt.Fprintf(w, "Free pages\t%d (%s)\n", stats.DB.FreePageN, formatBytes(int64(stats.DB.FreePageN*stats.PageSize)))
+	fmt.Fprintf(w, "Pending pages\t%d\n", stats.DB.PendingPageN)
+	fmt.Fprintf(w, "Read transactions\t%d (%d open)\n", stats.DB.TxN, stats.DB.OpenTxN)
+	w.Flush()
+	fmt.Println()
+
+	// The biggest buckets first, they are the ones worth looking at.
+	sort.SliceStable(stats.Children, func(i, j int) bool {
+		return allocated(stats.Children[i].BucketStats) > allocated(stats.Children[j].BucketStats)
+	})
+	total := model.NamedBucketStats{Name: "(total)", BucketStats: stats.Bucket}
+	fmt.Fprintln(w, "BUCKET\tALLOC\tIN USE\tKEYS\tBUCKETS\tINLINE\tDEPTH\tBRANCH PAGES\tLEAF PAGES\tOVERFLOW PAGES")
+	for _, b := range append([]model.NamedBucketStats{total}, stats.Children...) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", b.Name,
+			formatBytes(int64(allocated(b.BucketStats))),
+			formatBytes(int64(b.BranchInuse+b.LeafInuse)),
+			b.KeyN, b.BucketN, b.InlineBucketN, b.Depth,
+			b.BranchPageN, b.LeafPageN, b.BranchOverflowN+b.LeafOverflowN)
+	}
+	w.Flush()
+	if stats.ChildrenTruncated {
+		fmt.Printf("Only %d child buckets are listed\n", len(stats.Children))
+	}
+}
+
+func allocated(s model.BucketStats) int {
+	return s.BranchAlloc + s.LeafAlloc
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/xerrors"
+)
+
+// BSON decodes BSON documents into relaxed MongoDB Extended JSON, which
+// keeps types such as ObjectIDs and dates so that they survive an edit.
+var BSON Codec = bsonCodec{}
+
+type bsonCodec struct{}
+
+func (bsonCodec) Name() string {
+	return "bson"
+}
+
+func (bsonCodec) Detect(b []byte) bool {
+	// A document starts with its own length and ends with a NUL byte.
+	if len(b) < 5 || int(binary.LittleEndian.Uint32(b)) != len(b) || b[len(b)-1] != 0 {
+		return false
+	}
+	return bson.Raw(b).Validate() == nil
+}
+
+func (bsonCodec) Decode(b []byte) (string, error) {
+	out, err := bson.MarshalExtJSON(bson.Raw(b), false, false)
+	if err != nil {
+		return "", xerrors.Errorf("failed to decode bson: %w", err)
+	}
+	return string(out), nil
+}
+
+func (bsonCodec) Encode(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err = bson.UnmarshalExtJSON(b, false, &doc); err != nil {
+		return nil, xerrors.Errorf("value is not a BSON document: %w", err)
+	}
+	return bson.Marshal(doc)
+}
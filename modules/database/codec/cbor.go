@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/xerrors"
+)
+
+// CBOR decodes CBOR values whose top level is a map, an array or a tag,
+// such as the self-describe tag 55799.
+var CBOR Codec = cborCodec{}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) Detect(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	switch b[0] >> 5 { // major type
+	case 4, 5, 6: // array, map, tag
+	default:
+		return false
+	}
+	return cbor.Wellformed(b) == nil
+}
+
+func (cborCodec) Decode(b []byte) (string, error) {
+	var v interface{}
+	if err := cbor.Unmarshal(b, &v); err != nil {
+		return "", xerrors.Errorf("failed to decode cbor: %w", err)
+	}
+	return marshalJSON(v)
+}
+
+func (cborCodec) Encode(v interface{}) ([]byte, error) {
+	return cbor.Marshal(fromJSON(v))
+}
@@ -0,0 +1,149 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/utils"
+)
+
+// Cipher is the outermost layer of a stored value: values are decrypted
+// before they are decompressed and decoded, and encrypted last on write.
+type Cipher interface {
+	Name() string
+	Decrypt(b []byte) ([]byte, error)
+	Encrypt(b []byte) ([]byte, error)
+}
+
+// NonceLayout is where AES-GCM values keep their nonce.
+type NonceLayout string
+
+const (
+	// NoncePrefix stores the nonce before the ciphertext.
+	NoncePrefix NonceLayout = "prefix"
+	// NonceSuffix stores the nonce after the ciphertext.
+	NonceSuffix NonceLayout = "suffix"
+)
+
+type aesGCM struct {
+	aead   cipher.AEAD
+	layout NonceLayout
+}
+
+// NewAESGCM returns a cipher for values sealed with AES-GCM and a 12-byte
+// random nonce. The key must be 16, 24 or 32 bytes long.
+func NewAESGCM(key []byte, layout NonceLayout) (Cipher, error) {
+	if layout != NoncePrefix && layout != NonceSuffix {
+		return nil, xerrors.Errorf("unknown nonce layout: %s", layout)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		// The error only carries the key size.
+		return nil, xerrors.Errorf("invalid AES key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCM{aead: aead, layout: layout}, nil
+}
+
+// LoadKeyFile reads a key stored either as hex or base64 text, or as raw
+// bytes. Text is tried first, since a 32-character hex key is also 32 raw
+// bytes long; it is only used when it decodes to a valid AES key size.
+func LoadKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read key file: %w", err)
+	}
+	text := string(bytes.TrimSpace(b))
+	if key, err := hex.DecodeString(text); err == nil && validKeySize(len(key)) {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && validKeySize(len(key)) {
+		return key, nil
+	}
+	if validKeySize(len(b)) {
+		return b, nil
+	}
+	return nil, xerrors.Errorf("key file %s holds neither a 16, 24 or 32-byte key, nor its hex or base64 form", path)
+}
+
+func validKeySize(n int) bool {
+	switch n {
+	case 16, 24, 32:
+		return true
+	}
+	return false
+}
+
+func (c *aesGCM) Name() string {
+	return "aes-gcm"
+}
+
+// String keeps the key schedule out of logs.
+func (c *aesGCM) String() string {
+	return c.Name()
+}
+
+func (c *aesGCM) GoString() string {
+	return c.Name()
+}
+
+func (c *aesGCM) Decrypt(b []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(b) < size+c.aead.Overhead() {
+		return nil, xerrors.New("value is too short to be encrypted")
+	}
+	var nonce, ciphertext []byte
+	if c.layout == NoncePrefix {
+		nonce, ciphertext = b[:size], b[size:]
+	} else {
+		ciphertext, nonce = b[:len(b)-size], b[len(b)-size:]
+	}
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, xerrors.New("failed to decrypt value")
+	}
+	return plain, nil
+}
+
+func (c *aesGCM) Encrypt(b []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, xerrors.Errorf("failed to generate nonce: %w", err)
+	}
+	if c.layout == NoncePrefix {
+		return c.aead.Seal(nonce, nonce, b, nil), nil
+	}
+	return append(c.aead.Seal(nil, nonce, b, nil), nonce...), nil
+}
+
+type cipherRule struct {
+	pattern string
+	cipher  Cipher
+}
+
+// MapCipher encrypts the values of the buckets matching a level stack
+// pattern with c.
+func (r *Registry) MapCipher(pattern string, c Cipher) {
+	r.cipherRules = append(r.cipherRules, cipherRule{pattern: pattern, cipher: c})
+}
+
+// BucketCipher returns the cipher of the values stored under levelStack,
+// or nil when they are not encrypted.
+func (r *Registry) BucketCipher(levelStack []string) Cipher {
+	for _, rule := range r.cipherRules {
+		if utils.MatchLevelStack(rule.pattern, levelStack) {
+			return rule.cipher
+		}
+	}
+	return nil
+}
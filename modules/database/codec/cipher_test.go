@@ -0,0 +1,48 @@
+package codec
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeyFile(t *testing.T) {
+	key16 := []byte("0123456789abcdef")
+	key32 := bytes.Repeat([]byte{0x11}, 32)
+
+	tests := []struct {
+		name    string
+		content string
+		want    []byte
+		wantErr bool
+	}{
+		{name: "raw 32 bytes", content: string(key32), want: key32},
+		{name: "raw 16 bytes", content: string(key16), want: key16},
+		// A hex AES-128 key is 32 characters long, like a raw AES-256 key.
+		{name: "hex without newline", content: "00112233445566778899aabbccddeeff", want: []byte{
+			0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}},
+		{name: "hex with newline", content: "00112233445566778899aabbccddeeff\n", want: []byte{
+			0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}},
+		// A base64 AES-128 key is 24 characters long, like a raw AES-192 key.
+		{name: "base64 without newline", content: "MDEyMzQ1Njc4OWFiY2RlZg==", want: key16},
+		{name: "base64 with newline", content: "MDEyMzQ1Njc4OWFiY2RlZg==\n", want: key16},
+		{name: "hex of a wrong size", content: "0011", wantErr: true},
+		{name: "raw of a wrong size", content: "short", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadKeyFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("LoadKeyFile() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package codec
+
+import (
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/utils"
+)
+
+// Codec converts stored values to the form shown in the UI and back.
+// Implementations must be safe for concurrent use.
+type Codec interface {
+	// Name identifies the codec in bucket mappings and responses.
+	Name() string
+	// Detect reports whether b looks like a value produced by this codec.
+	// Codecs whose format has no recognisable signature return false and
+	// are only used for the buckets mapped to them.
+	Detect(b []byte) bool
+	// Decode returns the display form of a stored value, usually JSON.
+	Decode(b []byte) (string, error)
+	// Encode turns a JSON value from a request into the bytes to store.
+	Encode(v interface{}) ([]byte, error)
+}
+
+// Auto is the codec name that makes a bucket detect the codec of each
+// value from its content.
+const Auto = "auto"
+
+// Raw shows values as they are stored and writes values as JSON. It is
+// used when no other codec applies.
+var Raw Codec = rawCodec{}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string                         { return "raw" }
+func (rawCodec) Detect([]byte) bool                   { return true }
+func (rawCodec) Decode(b []byte) (string, error)      { return string(b), nil }
+func (rawCodec) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Registry holds the available codecs, compressions, ciphers and key
+// codecs, and the bucket patterns they are mapped to.
+type Registry struct {
+	codecs map[string]Codec
+	// detectors are tried in registration order by Detect.
+	detectors    []Codec
+	rules        []rule
+	compressions map[string]Compression
+	// compressionDetectors are tried in registration order by
+	// DetectCompression.
+	compressionDetectors []Compression
+	compressionRules     []compressionRule
+	cipherRules          []cipherRule
+	keyCodecs            map[string]KeyCodec
+	keyRules             []keyRule
+}
+
+type rule struct {
+	pattern string
+	// codec is nil for buckets mapped to Auto.
+	codec Codec
+}
+
+type compressionRule struct {
+	pattern string
+	// compression is nil for buckets mapped to Auto.
+	compression Compression
+}
+
+// NewRegistry returns a registry with the built-in codecs and
+// compressions. The self-describing formats are detected in the order
+// BSON, MessagePack, CBOR and gob.
+func NewRegistry() *Registry {
+	r := &Registry{
+		codecs:       map[string]Codec{Raw.Name(): Raw},
+		compressions: map[string]Compression{None.Name(): None},
+		keyCodecs:    map[string]KeyCodec{},
+	}
+	for _, c := range []Codec{ProtoWire, BSON, MsgPack, CBOR, Gob} {
+		_ = r.Register(c)
+	}
+	for _, c := range []Compression{Gzip, Zstd, Snappy, SnappyFramed, LZ4} {
+		r.compressions[c.Name()] = c
+		r.compressionDetectors = append(r.compressionDetectors, c)
+	}
+	for _, c := range []KeyCodec{Uint64BE, Uint64LE, Int64, Time, UUID, Hex, Tuple} {
+		_ = r.RegisterKeyCodec(c)
+	}
+	return r
+}
+
+// Register adds a codec, which can then be mapped to buckets by name and
+// takes part in content detection.
+func (r *Registry) Register(c Codec) error {
+	if _, ok := r.codecs[c.Name()]; ok || c.Name() == Auto {
+		return xerrors.Errorf("codec %q is already registered", c.Name())
+	}
+	r.codecs[c.Name()] = c
+	r.detectors = append(r.detectors, c)
+	return nil
+}
+
+func (r *Registry) Lookup(name string) (Codec, bool) {
+	c, ok := r.codecs[name]
+	return c, ok
+}
+
+// Map binds the buckets matching a level stack pattern (see
+// utils.MatchLevelStack) to a registered codec or to Auto. Mappings are
+// tried in the order they were added.
+func (r *Registry) Map(pattern, name string) error {
+	if name == Auto {
+		r.rules = append(r.rules, rule{pattern: pattern})
+		return nil
+	}
+	c, ok := r.codecs[name]
+	if !ok {
+		return xerrors.Errorf("unknown codec: %s", name)
+	}
+	r.rules = append(r.rules, rule{pattern: pattern, codec: c})
+	return nil
+}
+
+// Bucket returns the codec for the values stored under levelStack, or nil
+// when each value should be passed to Detect. Buckets without a mapping
+// are detected.
+func (r *Registry) Bucket(levelStack []string) Codec {
+	for _, rule := range r.rules {
+		if utils.MatchLevelStack(rule.pattern, levelStack) {
+			return rule.codec
+		}
+	}
+	return nil
+}
+
+// Detect returns the first registered codec that recognises b, or Raw.
+func (r *Registry) Detect(b []byte) Codec {
+	for _, c := range r.detectors {
+		if c.Detect(b) {
+			return c
+		}
+	}
+	return Raw
+}
+
+// MapCompression binds the buckets matching a level stack pattern to a
+// compression, to None or to Auto.
+func (r *Registry) MapCompression(pattern, name string) error {
+	if name == Auto {
+		r.compressionRules = append(r.compressionRules, compressionRule{pattern: pattern})
+		return nil
+	}
+	c, ok := r.compressions[name]
+	if !ok {
+		return xerrors.Errorf("unknown compression: %s", name)
+	}
+	r.compressionRules = append(r.compressionRules, compressionRule{pattern: pattern, compression: c})
+	return nil
+}
+
+// BucketCompression returns the compression of the values stored under
+// levelStack, or nil when it is detected from each value.
+func (r *Registry) BucketCompression(levelStack []string) Compression {
+	for _, rule := range r.compressionRules {
+		if utils.MatchLevelStack(rule.pattern, levelStack) {
+			return rule.compression
+		}
+	}
+	return nil
+}
+
+// DetectCompression returns the first compression whose magic bytes start
+// b, or None.
+func (r *Registry) DetectCompression(b []byte) Compression {
+	for _, c := range r.compressionDetectors {
+		if c.Detect(b) {
+			return c
+		}
+	}
+	return None
+}
+
+// ParseMapping splits a "<bucket pattern>=<name>" mapping.
+func ParseMapping(s string) (pattern, name string, err error) {
+	pattern, name, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" || name == "" {
+		return "", "", xerrors.Errorf("invalid mapping %q, expected <bucket pattern>=<name>", s)
+	}
+	return pattern, name, nil
+}
@@ -0,0 +1,219 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"golang.org/x/xerrors"
+)
+
+// Compression is applied to stored values around their codec: values are
+// decompressed before they are decoded, and compressed again after they
+// are encoded.
+type Compression interface {
+	// Name identifies the compression in bucket mappings and responses.
+	Name() string
+	// Detect reports whether b starts with the magic bytes of this format.
+	// Formats without magic bytes return false and are only used for the
+	// buckets mapped to them.
+	Detect(b []byte) bool
+	Decompress(b []byte) ([]byte, error)
+	Compress(b []byte) ([]byte, error)
+}
+
+// None leaves values as they are. It is used when no other compression
+// applies.
+var None Compression = noCompression{}
+
+type noCompression struct{}
+
+func (noCompression) Name() string                        { return "none" }
+func (noCompression) Detect([]byte) bool                  { return false }
+func (noCompression) Decompress(b []byte) ([]byte, error) { return b, nil }
+func (noCompression) Compress(b []byte) ([]byte, error)   { return b, nil }
+
+var (
+	Gzip         Compression = gzipCompression{}
+	Zstd         Compression = zstdCompression{}
+	Snappy       Compression = snappyCompression{}
+	SnappyFramed Compression = snappyFramedCompression{}
+	LZ4          Compression = lz4Compression{}
+)
+
+type gzipCompression struct{}
+
+func (gzipCompression) Name() string {
+	return "gzip"
+}
+
+func (gzipCompression) Detect(b []byte) bool {
+	return bytes.HasPrefix(b, []byte{0x1f, 0x8b})
+}
+
+func (gzipCompression) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read gzip header: %w", err)
+	}
+	return readAll(r)
+}
+
+func (gzipCompression) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type zstdCompression struct{}
+
+func (zstdCompression) Name() string {
+	return "zstd"
+}
+
+func (zstdCompression) Detect(b []byte) bool {
+	return bytes.HasPrefix(b, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
+
+// zstdDecoder and zstdEncoder are shared by all the values, DecodeAll and
+// EncodeAll can be called concurrently.
+var (
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	})
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+)
+
+func (zstdCompression) Decompress(b []byte) ([]byte, error) {
+	d, err := zstdDecoder()
+	if err != nil {
+		return nil, err
+	}
+	out, err := d.DecodeAll(b, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decompress zstd: %w", err)
+	}
+	return out, nil
+}
+
+func (zstdCompression) Compress(b []byte) ([]byte, error) {
+	e, err := zstdEncoder()
+	if err != nil {
+		return nil, err
+	}
+	return e.EncodeAll(b, nil), nil
+}
+
+// snappyCompression is the snappy block format, which has no magic bytes.
+type snappyCompression struct{}
+
+func (snappyCompression) Name() string {
+	return "snappy"
+}
+
+func (snappyCompression) Detect([]byte) bool {
+	return false
+}
+
+func (snappyCompression) Decompress(b []byte) ([]byte, error) {
+	// Decode allocates the length claimed by the header before checking
+	// anything.
+	n, err := snappy.DecodedLen(b)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decompress snappy: %w", err)
+	}
+	if n > maxDecompressedSize {
+		return nil, xerrors.Errorf("decompressed value exceeds %d bytes", maxDecompressedSize)
+	}
+	out, err := snappy.Decode(nil, b)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decompress snappy: %w", err)
+	}
+	return out, nil
+}
+
+func (snappyCompression) Compress(b []byte) ([]byte, error) {
+	return snappy.Encode(nil, b), nil
+}
+
+// snappyFramedCompression is the snappy framing format, which starts with
+// a stream identifier chunk.
+type snappyFramedCompression struct{}
+
+func (snappyFramedCompression) Name() string {
+	return "snappy-framed"
+}
+
+func (snappyFramedCompression) Detect(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("\xff\x06\x00\x00sNaPpY"))
+}
+
+func (snappyFramedCompression) Decompress(b []byte) ([]byte, error) {
+	return readAll(snappy.NewReader(bytes.NewReader(b)))
+}
+
+func (snappyFramedCompression) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lz4Compression is the LZ4 frame format.
+type lz4Compression struct{}
+
+func (lz4Compression) Name() string {
+	return "lz4"
+}
+
+func (lz4Compression) Detect(b []byte) bool {
+	return bytes.HasPrefix(b, []byte{0x04, 0x22, 0x4d, 0x18})
+}
+
+func (lz4Compression) Decompress(b []byte) ([]byte, error) {
+	return readAll(lz4.NewReader(bytes.NewReader(b)))
+}
+
+func (lz4Compression) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// maxDecompressedSize guards against values that decompress to huge
+// outputs, for every compression.
+const maxDecompressedSize = 256 << 20
+
+func readAll(r io.Reader) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decompress: %w", err)
+	}
+	if len(out) > maxDecompressedSize {
+		return nil, xerrors.Errorf("decompressed value exceeds %d bytes", maxDecompressedSize)
+	}
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	value := bytes.Repeat([]byte(`{"name":"boltwiz"}`), 100)
+	for _, c := range []Compression{None, Gzip, Zstd, Snappy, SnappyFramed, LZ4} {
+		t.Run(c.Name(), func(t *testing.T) {
+			compressed, err := c.Compress(value)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if c != None && c != Snappy && !c.Detect(compressed) {
+				t.Error("Detect() = false on a compressed value")
+			}
+			got, err := c.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("Decompress() error = %v", err)
+			}
+			if !bytes.Equal(got, value) {
+				t.Errorf("Decompress() = %q, want %q", got, value)
+			}
+		})
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	// A zstd stream of zeros larger than the limit, written without its
+	// content size.
+	var zstdBomb bytes.Buffer
+	w, err := zstd.NewWriter(&zstdBomb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < maxDecompressedSize>>20+1; i++ {
+		if _, err = w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A snappy block claiming 4 GiB.
+	snappyBomb := binary.AppendUvarint(nil, 1<<32-1)
+	snappyBomb = append(snappyBomb, 0x00, 0x00)
+
+	tests := []struct {
+		name  string
+		c     Compression
+		value []byte
+	}{
+		{name: "zstd", c: Zstd, value: zstdBomb.Bytes()},
+		{name: "snappy", c: Snappy, value: snappyBomb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.c.Decompress(tt.value)
+			if err == nil {
+				t.Fatal("Decompress() error = nil, want a size error")
+			}
+			if !strings.Contains(err.Error(), "exceed") {
+				t.Errorf("Decompress() error = %v, want a size error", err)
+			}
+		})
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	r := NewRegistry()
+	value := bytes.Repeat([]byte("boltwiz "), 100)
+	for _, c := range []Compression{Gzip, Zstd, SnappyFramed, LZ4} {
+		t.Run(c.Name(), func(t *testing.T) {
+			compressed, err := c.Compress(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.DetectCompression(compressed); got != c {
+				t.Errorf("DetectCompression() = %s, want %s", got.Name(), c.Name())
+			}
+		})
+	}
+	if got := r.DetectCompression(value); got != None {
+		t.Errorf("DetectCompression() = %s on an uncompressed value", got.Name())
+	}
+}
@@ -0,0 +1,470 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// Gob decodes encoding/gob streams holding a single value. The Go types of
+// the value are not known here, so the value is rebuilt from the type
+// definitions carried in the stream, structs becoming JSON objects. Gob
+// values are read-only.
+var Gob Codec = gobCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Detect(b []byte) bool {
+	_, err := decodeGob(b)
+	return err == nil
+}
+
+func (gobCodec) Decode(b []byte) (string, error) {
+	v, err := decodeGob(b)
+	if err != nil {
+		return "", xerrors.Errorf("failed to decode gob: %w", err)
+	}
+	return marshalJSON(v)
+}
+
+func (gobCodec) Encode(interface{}) ([]byte, error) {
+	return nil, xerrors.New("gob values cannot be written without their Go types")
+}
+
+// Predefined gob type ids, see encoding/gob/type.go.
+const (
+	gobBool      = 1
+	gobInt       = 2
+	gobUint      = 3
+	gobFloat     = 4
+	gobBytes     = 5
+	gobString    = 6
+	gobComplex   = 7
+	gobInterface = 8
+)
+
+const (
+	gobArrayKind = iota + 1
+	gobSliceKind
+	gobStructKind
+	gobMapKind
+	gobEncoderKind
+	gobTextMarshalerKind
+)
+
+type gobType struct {
+	kind      int
+	elem, key int
+	fields    []gobField
+}
+
+type gobField struct {
+	name string
+	id   int
+}
+
+// gobDecoder mirrors the message framing of encoding/gob.Decoder: the
+// stream is a sequence of length-prefixed messages, and values are read
+// from the current message.
+type gobDecoder struct {
+	stream *bytes.Reader
+	buf    *bytes.Reader
+	types  map[int]gobType
+}
+
+func decodeGob(b []byte) (interface{}, error) {
+	d := &gobDecoder{
+		stream: bytes.NewReader(b),
+		buf:    bytes.NewReader(nil),
+		types:  map[int]gobType{},
+	}
+	id, err := d.typeSequence(false)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if t, ok := d.types[id]; ok && t.kind == gobStructKind {
+		v, err = d.value(id)
+	} else {
+		// Top-level values other than structs are sent as a singleton
+		// field with a zero delta.
+		var delta uint64
+		if delta, err = d.uint(); err == nil && delta != 0 {
+			err = xerrors.New("non-zero delta for singleton")
+		}
+		if err == nil {
+			v, err = d.value(id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.buf.Len() > 0 || d.stream.Len() > 0 {
+		return nil, xerrors.New("trailing data after value")
+	}
+	return v, nil
+}
+
+// typeSequence reads type definitions until the id of a value is found.
+func (d *gobDecoder) typeSequence(isInterface bool) (int, error) {
+	for {
+		if d.buf.Len() == 0 {
+			if err := d.recvMessage(); err != nil {
+				return 0, err
+			}
+		}
+		id, err := d.int()
+		if err != nil {
+			return 0, err
+		}
+		if id >= 0 {
+			return int(id), nil
+		}
+		if err = d.recvType(int(-id)); err != nil {
+			return 0, err
+		}
+		// Inside an interface, the type may be followed by the byte
+		// count of the value.
+		if d.buf.Len() > 0 {
+			if !isInterface {
+				return 0, xerrors.New("extra data in buffer")
+			}
+			if _, err = d.uint(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func (d *gobDecoder) recvMessage() error {
+	n, err := readGobUint(d.stream)
+	if err != nil {
+		return err
+	}
+	if n == 0 || n > uint64(d.stream.Len()) {
+		return xerrors.Errorf("invalid message length %d", n)
+	}
+	msg := make([]byte, n)
+	_, _ = d.stream.Read(msg)
+	d.buf = bytes.NewReader(msg)
+	return nil
+}
+
+// recvType reads a wireType definition.
+func (d *gobDecoder) recvType(id int) error {
+	if _, ok := d.types[id]; ok || id < 64 {
+		return xerrors.Errorf("invalid type id %d", id)
+	}
+	var t gobType
+	err := d.fields(func(field int) error {
+		switch field {
+		case 0: // ArrayT
+			t.kind = gobArrayKind
+			return d.fields(func(field int) error {
+				switch field {
+				case 0:
+					return d.commonType()
+				case 1:
+					return d.typeID(&t.elem)
+				case 2:
+					_, err := d.int()
+					return err
+				}
+				return xerrors.Errorf("unexpected array type field %d", field)
+			})
+		case 1: // SliceT
+			t.kind = gobSliceKind
+			return d.fields(func(field int) error {
+				switch field {
+				case 0:
+					return d.commonType()
+				case 1:
+					return d.typeID(&t.elem)
+				}
+				return xerrors.Errorf("unexpected slice type field %d", field)
+			})
+		case 2: // StructT
+			t.kind = gobStructKind
+			return d.fields(func(field int) error {
+				switch field {
+				case 0:
+					return d.commonType()
+				case 1:
+					n, err := d.count()
+					if err != nil {
+						return err
+					}
+					for i := 0; i < n; i++ {
+						var f gobField
+						err = d.fields(func(field int) error {
+							switch field {
+							case 0:
+								s, err := d.bytes()
+								f.name = string(s)
+								return err
+							case 1:
+								return d.typeID(&f.id)
+							}
+							return xerrors.Errorf("unexpected field type field %d", field)
+						})
+						if err != nil {
+							return err
+						}
+						t.fields = append(t.fields, f)
+					}
+					return nil
+				}
+				return xerrors.Errorf("unexpected struct type field %d", field)
+			})
+		case 3: // MapT
+			t.kind = gobMapKind
+			return d.fields(func(field int) error {
+				switch field {
+				case 0:
+					return d.commonType()
+				case 1:
+					return d.typeID(&t.key)
+				case 2:
+					return d.typeID(&t.elem)
+				}
+				return xerrors.Errorf("unexpected map type field %d", field)
+			})
+		case 4, 5, 6: // GobEncoderT, BinaryMarshalerT, TextMarshalerT
+			t.kind = gobEncoderKind
+			if field == 6 {
+				t.kind = gobTextMarshalerKind
+			}
+			return d.fields(func(field int) error {
+				if field != 0 {
+					return xerrors.Errorf("unexpected encoder type field %d", field)
+				}
+				return d.commonType()
+			})
+		}
+		return xerrors.Errorf("unexpected wire type field %d", field)
+	})
+	if err != nil {
+		return err
+	}
+	if t.kind == 0 {
+		return xerrors.Errorf("empty definition for type %d", id)
+	}
+	d.types[id] = t
+	return nil
+}
+
+func (d *gobDecoder) commonType() error {
+	return d.fields(func(field int) error {
+		switch field {
+		case 0:
+			_, err := d.bytes()
+			return err
+		case 1:
+			_, err := d.int()
+			return err
+		}
+		return xerrors.Errorf("unexpected common type field %d", field)
+	})
+}
+
+func (d *gobDecoder) typeID(id *int) error {
+	i, err := d.int()
+	*id = int(i)
+	return err
+}
+
+// fields reads the delta-encoded fields of a struct, calling fn with the
+// number of each field present.
+func (d *gobDecoder) fields(fn func(field int) error) error {
+	field := -1
+	for {
+		delta, err := d.uint()
+		if err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		if delta > math.MaxInt32 {
+			return xerrors.Errorf("invalid field delta %d", delta)
+		}
+		field += int(delta)
+		if err = fn(field); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *gobDecoder) value(id int) (interface{}, error) {
+	switch id {
+	case gobBool:
+		u, err := d.uint()
+		return u != 0, err
+	case gobInt:
+		return d.int()
+	case gobUint:
+		return d.uint()
+	case gobFloat:
+		return d.float()
+	case gobBytes:
+		return d.bytes()
+	case gobString:
+		b, err := d.bytes()
+		return string(b), err
+	case gobComplex:
+		re, err := d.float()
+		if err != nil {
+			return nil, err
+		}
+		im, err := d.float()
+		return map[string]interface{}{"real": re, "imag": im}, err
+	case gobInterface:
+		return d.interfaceValue()
+	}
+
+	t, ok := d.types[id]
+	if !ok {
+		return nil, xerrors.Errorf("unknown type id %d", id)
+	}
+	switch t.kind {
+	case gobArrayKind, gobSliceKind:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		s := make([]interface{}, n)
+		for i := range s {
+			if s[i], err = d.value(t.elem); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case gobMapKind:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := d.value(t.key)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case []byte, []interface{}, map[string]interface{}, map[interface{}]interface{}:
+				// Struct and array keys are not hashable once decoded.
+				k = fmt.Sprint(k)
+			}
+			if m[k], err = d.value(t.elem); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case gobStructKind:
+		m := map[string]interface{}{}
+		err := d.fields(func(field int) error {
+			if field >= len(t.fields) {
+				return xerrors.Errorf("unexpected field %d of type %d", field, id)
+			}
+			v, err := d.value(t.fields[field].id)
+			m[t.fields[field].name] = v
+			return err
+		})
+		return m, err
+	case gobEncoderKind:
+		return d.bytes()
+	case gobTextMarshalerKind:
+		b, err := d.bytes()
+		return string(b), err
+	}
+	return nil, xerrors.Errorf("unknown type id %d", id)
+}
+
+func (d *gobDecoder) interfaceValue() (interface{}, error) {
+	name, err := d.bytes()
+	if err != nil || len(name) == 0 {
+		return nil, err
+	}
+	id, err := d.typeSequence(true)
+	if err != nil {
+		return nil, err
+	}
+	// Byte count of the value.
+	if _, err = d.uint(); err != nil {
+		return nil, err
+	}
+	if t, ok := d.types[id]; !ok || t.kind != gobStructKind {
+		if delta, err := d.uint(); err != nil || delta != 0 {
+			return nil, xerrors.New("invalid interface value")
+		}
+	}
+	return d.value(id)
+}
+
+func (d *gobDecoder) uint() (uint64, error) {
+	return readGobUint(d.buf)
+}
+
+func (d *gobDecoder) int() (int64, error) {
+	u, err := d.uint()
+	i := int64(u >> 1)
+	if u&1 != 0 {
+		i = ^i
+	}
+	return i, err
+}
+
+func (d *gobDecoder) float() (float64, error) {
+	u, err := d.uint()
+	return math.Float64frombits(bits.ReverseBytes64(u)), err
+}
+
+// count reads a length and checks it against the remaining input.
+func (d *gobDecoder) count() (int, error) {
+	n, err := d.uint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(d.buf.Len()) {
+		return 0, xerrors.Errorf("invalid length %d", n)
+	}
+	return int(n), nil
+}
+
+func (d *gobDecoder) bytes() ([]byte, error) {
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, _ = d.buf.Read(b)
+	return b, nil
+}
+
+func readGobUint(r *bytes.Reader) (uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if c <= 0x7f {
+		return uint64(c), nil
+	}
+	n := -int(int8(c))
+	if n > 8 || n > r.Len() {
+		return 0, xerrors.New("invalid uint")
+	}
+	var x uint64
+	for i := 0; i < n; i++ {
+		c, _ = r.ReadByte()
+		x = x<<8 | uint64(c)
+	}
+	return x, nil
+}
@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"testing"
+)
+
+type gobInner struct {
+	Name string
+	Tags []string
+}
+
+type gobOuter struct {
+	ID      uint64
+	Delta   int32
+	Ratio   float64
+	Enabled bool
+	Inner   gobInner
+	Ptr     *gobInner
+	Counts  map[string]int
+	ByID    map[int]string
+	Raw     []byte
+	Any     interface{}
+	Skipped int
+}
+
+type gobShape struct {
+	Sides int
+}
+
+func init() {
+	gob.Register(gobShape{})
+}
+
+func TestGobDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "int", value: -42, want: `-42`},
+		{name: "uint64", value: uint64(math.MaxUint64), want: `18446744073709551615`},
+		{name: "float", value: 0.25, want: `0.25`},
+		{name: "string", value: "boltwiz", want: `"boltwiz"`},
+		{name: "bool", value: true, want: `true`},
+		{name: "complex", value: complex(1, -2), want: `{"imag":-2,"real":1}`},
+		{name: "slice", value: []int{1, 2, 3}, want: `[1,2,3]`},
+		{name: "array", value: [2]string{"a", "b"}, want: `["a","b"]`},
+		{name: "map", value: map[string]bool{"x": true}, want: `{"x":true}`},
+		{
+			name: "struct",
+			value: gobOuter{
+				ID:      math.MaxUint64,
+				Delta:   -7,
+				Ratio:   1.5,
+				Enabled: true,
+				Inner:   gobInner{Name: "inner", Tags: []string{"t"}},
+				Ptr:     &gobInner{Name: "ptr"},
+				Counts:  map[string]int{"a": 1},
+				ByID:    map[int]string{2: "two"},
+				Raw:     []byte{0xde, 0xad},
+				Any:     gobShape{Sides: 3},
+			},
+			// Gob does not send zero fields, Skipped is left out.
+			want: `{"Any":{"Sides":3},"ByID":{"2":"two"},"Counts":{"a":1},"Delta":-7,"Enabled":true,"ID":18446744073709551615,` +
+				`"Inner":{"Name":"inner","Tags":["t"]},"Ptr":{"Name":"ptr"},"Ratio":1.5,"Raw":"3q0="}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if !Gob.Detect(buf.Bytes()) {
+				t.Error("Detect() = false")
+			}
+			got, err := Gob.Decode(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGobDecode_invalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobInner{Name: "inner"}); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "json", value: []byte(`{"Name":"inner"}`)},
+		{name: "truncated", value: valid[:len(valid)-1]},
+		{name: "trailing data", value: append(append([]byte{}, valid...), 0x00)},
+		{name: "empty", value: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Gob.Detect(tt.value) {
+				t.Error("Detect() = true")
+			}
+			if _, err := Gob.Decode(tt.value); err == nil {
+				t.Error("Decode() error = nil")
+			}
+		})
+	}
+}
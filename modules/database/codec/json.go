@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// marshalJSON renders a generically decoded value as JSON. Maps with
+// non-string keys, which JSON cannot represent, get their keys formatted
+// with fmt.
+func marshalJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(jsonSafe(v))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func jsonSafe(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonSafe(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = jsonSafe(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonSafe(val)
+		}
+		return v
+	}
+	return v
+}
+
+// fromJSON prepares a value decoded from a JSON request for a binary
+// format, storing whole numbers as integers rather than as floats. Requests
+// should be decoded with json.Decoder.UseNumber: integers above 2^53 do not
+// survive a float64.
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return fromJSON(f)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v)
+		}
+		return v
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = fromJSON(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = fromJSON(val)
+		}
+		return v
+	}
+	return v
+}
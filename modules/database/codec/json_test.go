@@ -0,0 +1,66 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// decodeRequest decodes a request value the way the handlers do.
+func decodeRequest(t *testing.T, s string) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// TestRoundTrip64Bit checks that values shown by Decode are stored again
+// unchanged, including integers JSON numbers cannot hold in a float64.
+func TestRoundTrip64Bit(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+		value string
+	}{
+		{name: "msgpack uint64", codec: MsgPack, value: `{"id":18446744073709551615}`},
+		{name: "msgpack int64", codec: MsgPack, value: `{"id":-9007199254740993}`},
+		{name: "msgpack float", codec: MsgPack, value: `{"ratio":0.5}`},
+		{name: "cbor uint64", codec: CBOR, value: `{"id":18446744073709551615}`},
+		{name: "cbor int64", codec: CBOR, value: `{"id":-9007199254740993}`},
+		{name: "protowire negative varint", codec: ProtoWire, value: `[{"field":1,"wire_type":"varint","varint":"18446744073709551615"}]`},
+		{name: "protowire fixed64", codec: ProtoWire, value: `[{"field":2,"wire_type":"fixed64","fixed64":"9007199254740993"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := tt.codec.Encode(decodeRequest(t, tt.value))
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := tt.codec.Decode(stored)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != tt.value {
+				t.Errorf("Decode() = %s, want %s", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestProtoWireNumbers(t *testing.T) {
+	// Numbers are still accepted, as long as they fit.
+	stored, err := ProtoWire.Encode(decodeRequest(t, `[{"field":1,"wire_type":"varint","varint":150}]`))
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if want := []byte{0x08, 0x96, 0x01}; !bytes.Equal(stored, want) {
+		t.Errorf("Encode() = %x, want %x", stored, want)
+	}
+	if _, err = ProtoWire.Encode(decodeRequest(t, `[{"field":1,"wire_type":"varint","varint":"-1"}]`)); err == nil {
+		t.Error("Encode() of a negative varint succeeded")
+	}
+}
@@ -0,0 +1,223 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/utils"
+)
+
+// KeyCodec converts binary keys, and the names of nested buckets, to a
+// readable form and back.
+type KeyCodec interface {
+	Name() string
+	Decode(k []byte) (string, error)
+	Encode(s string) ([]byte, error)
+}
+
+var (
+	// Uint64BE and Uint64LE are 8-byte unsigned integers, such as the IDs
+	// returned by Bucket.NextSequence.
+	Uint64BE KeyCodec = uint64Key{name: "uint64be", order: binary.BigEndian}
+	Uint64LE KeyCodec = uint64Key{name: "uint64le", order: binary.LittleEndian}
+	// Int64 is an 8-byte big-endian signed integer.
+	Int64 KeyCodec = int64Key{}
+	// Time is an 8-byte big-endian count of Unix nanoseconds, shown in
+	// RFC 3339 format.
+	Time KeyCodec = timeKey{}
+	// UUID is a 16-byte UUID, shown in its canonical form.
+	UUID KeyCodec = uuidKey{}
+	// Hex shows keys as hexadecimal.
+	Hex KeyCodec = hexKey{}
+	// Tuple is a sequence of segments, each prefixed with its length as a
+	// uvarint, shown as a JSON array of strings.
+	Tuple KeyCodec = tupleKey{}
+)
+
+type uint64Key struct {
+	name  string
+	order binary.ByteOrder
+}
+
+func (c uint64Key) Name() string {
+	return c.name
+}
+
+func (c uint64Key) Decode(k []byte) (string, error) {
+	if len(k) != 8 {
+		return "", xerrors.Errorf("%s key must be 8 bytes, got %d", c.name, len(k))
+	}
+	return strconv.FormatUint(c.order.Uint64(k), 10), nil
+}
+
+func (c uint64Key) Encode(s string) ([]byte, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid %s key %q: %w", c.name, s, err)
+	}
+	k := make([]byte, 8)
+	c.order.PutUint64(k, n)
+	return k, nil
+}
+
+type int64Key struct{}
+
+func (int64Key) Name() string {
+	return "int64"
+}
+
+func (int64Key) Decode(k []byte) (string, error) {
+	if len(k) != 8 {
+		return "", xerrors.Errorf("int64 key must be 8 bytes, got %d", len(k))
+	}
+	return strconv.FormatInt(int64(binary.BigEndian.Uint64(k)), 10), nil
+}
+
+func (int64Key) Encode(s string) ([]byte, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid int64 key %q: %w", s, err)
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(n)), nil
+}
+
+type timeKey struct{}
+
+func (timeKey) Name() string {
+	return "time"
+}
+
+func (timeKey) Decode(k []byte) (string, error) {
+	if len(k) != 8 {
+		return "", xerrors.Errorf("time key must be 8 bytes, got %d", len(k))
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k))).UTC().Format(time.RFC3339Nano), nil
+}
+
+func (timeKey) Encode(s string) ([]byte, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid time key %q: %w", s, err)
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano())), nil
+}
+
+type uuidKey struct{}
+
+func (uuidKey) Name() string {
+	return "uuid"
+}
+
+func (uuidKey) Decode(k []byte) (string, error) {
+	if len(k) != 16 {
+		return "", xerrors.Errorf("uuid key must be 16 bytes, got %d", len(k))
+	}
+	h := hex.EncodeToString(k)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+func (uuidKey) Encode(s string) ([]byte, error) {
+	k, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(k) != 16 {
+		return nil, xerrors.Errorf("invalid uuid key %q", s)
+	}
+	return k, nil
+}
+
+type hexKey struct{}
+
+func (hexKey) Name() string {
+	return "hex"
+}
+
+func (hexKey) Decode(k []byte) (string, error) {
+	return hex.EncodeToString(k), nil
+}
+
+func (hexKey) Encode(s string) ([]byte, error) {
+	k, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid hex key %q: %w", s, err)
+	}
+	return k, nil
+}
+
+type tupleKey struct{}
+
+func (tupleKey) Name() string {
+	return "tuple"
+}
+
+func (tupleKey) Decode(k []byte) (string, error) {
+	segments := []string{}
+	for len(k) > 0 {
+		n, size := binary.Uvarint(k)
+		if size <= 0 || n > uint64(len(k)-size) {
+			return "", xerrors.New("invalid tuple key")
+		}
+		k = k[size:]
+		segments = append(segments, string(k[:n]))
+		k = k[n:]
+	}
+	b, err := json.Marshal(segments)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (tupleKey) Encode(s string) ([]byte, error) {
+	var segments []string
+	if err := json.Unmarshal([]byte(s), &segments); err != nil {
+		return nil, xerrors.Errorf("tuple key must be a JSON array of strings: %w", err)
+	}
+	var k []byte
+	for _, segment := range segments {
+		k = binary.AppendUvarint(k, uint64(len(segment)))
+		k = append(k, segment...)
+	}
+	return k, nil
+}
+
+type keyRule struct {
+	pattern string
+	codec   KeyCodec
+}
+
+// RegisterKeyCodec adds a key codec, which can then be mapped to buckets
+// by name.
+func (r *Registry) RegisterKeyCodec(c KeyCodec) error {
+	if _, ok := r.keyCodecs[c.Name()]; ok {
+		return xerrors.Errorf("key codec %q is already registered", c.Name())
+	}
+	r.keyCodecs[c.Name()] = c
+	return nil
+}
+
+// MapKey binds the keys of the buckets matching a level stack pattern to
+// a registered key codec.
+func (r *Registry) MapKey(pattern, name string) error {
+	c, ok := r.keyCodecs[name]
+	if !ok {
+		return xerrors.Errorf("unknown key codec: %s", name)
+	}
+	r.keyRules = append(r.keyRules, keyRule{pattern: pattern, codec: c})
+	return nil
+}
+
+// BucketKey returns the codec of the keys in the bucket at levelStack, or
+// nil when they are shown as stored.
+func (r *Registry) BucketKey(levelStack []string) KeyCodec {
+	for _, rule := range r.keyRules {
+		if utils.MatchLevelStack(rule.pattern, levelStack) {
+			return rule.codec
+		}
+	}
+	return nil
+}
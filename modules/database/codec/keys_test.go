@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		codec  KeyCodec
+		stored []byte
+		want   string
+	}{
+		{name: "uint64be", codec: Uint64BE, stored: []byte{0, 0, 0, 0, 0, 0, 1, 0}, want: "256"},
+		{name: "uint64be max", codec: Uint64BE, stored: bytes.Repeat([]byte{0xff}, 8), want: "18446744073709551615"},
+		{name: "uint64le", codec: Uint64LE, stored: []byte{0, 1, 0, 0, 0, 0, 0, 0}, want: "256"},
+		{name: "int64", codec: Int64, stored: bytes.Repeat([]byte{0xff}, 8), want: "-1"},
+		{name: "int64 positive", codec: Int64, stored: []byte{0, 0, 0, 0, 0, 0, 0, 42}, want: "42"},
+		{name: "time", codec: Time, stored: []byte{0x17, 0xa6, 0x37, 0x61, 0x51, 0x68, 0x4d, 0x15}, want: "2024-01-01T12:00:00.123456789Z"},
+		{name: "time epoch", codec: Time, stored: make([]byte, 8), want: "1970-01-01T00:00:00Z"},
+		{
+			name:   "uuid",
+			codec:  UUID,
+			stored: []byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00},
+			want:   "123e4567-e89b-12d3-a456-426614174000",
+		},
+		{name: "hex", codec: Hex, stored: []byte{0xde, 0xad, 0xbe, 0xef}, want: "deadbeef"},
+		{name: "tuple", codec: Tuple, stored: []byte("\x05users\x0242\x00"), want: `["users","42",""]`},
+		{name: "empty tuple", codec: Tuple, stored: nil, want: `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.codec.Decode(tt.stored)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() = %s, want %s", got, tt.want)
+			}
+			stored, err := tt.codec.Encode(got)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(stored, tt.stored) {
+				t.Errorf("Encode() = %x, want %x", stored, tt.stored)
+			}
+		})
+	}
+}
+
+func TestKeyCodec_invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		codec  KeyCodec
+		stored []byte
+		shown  string
+	}{
+		{name: "uint64be", codec: Uint64BE, stored: []byte{1, 2, 3}, shown: "-1"},
+		{name: "int64", codec: Int64, stored: make([]byte, 9), shown: "1.5"},
+		{name: "time", codec: Time, stored: make([]byte, 4), shown: "2024-01-01"},
+		{name: "uuid", codec: UUID, stored: make([]byte, 15), shown: "123e4567-e89b"},
+		{name: "tuple", codec: Tuple, stored: []byte("\x05abc"), shown: `"users"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.codec.Decode(tt.stored); err == nil {
+				t.Error("Decode() error = nil")
+			}
+			if _, err := tt.codec.Encode(tt.shown); err == nil {
+				t.Error("Encode() error = nil")
+			}
+		})
+	}
+}
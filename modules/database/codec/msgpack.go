@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/xerrors"
+)
+
+// MsgPack decodes MessagePack values whose top level is a map or an array.
+// Scalars are not detected, since every ASCII byte is a valid MessagePack
+// integer.
+var MsgPack Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (c msgpackCodec) Detect(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	switch t := b[0]; {
+	case t >= 0x80 && t <= 0x9f: // fixmap, fixarray
+	case t >= 0xdc && t <= 0xdf: // array 16/32, map 16/32
+	default:
+		return false
+	}
+	_, err := c.decode(b)
+	return err == nil
+}
+
+func (c msgpackCodec) Decode(b []byte) (string, error) {
+	v, err := c.decode(b)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSON(v)
+}
+
+func (msgpackCodec) decode(b []byte) (interface{}, error) {
+	r := bytes.NewReader(b)
+	var v interface{}
+	if err := msgpack.NewDecoder(r).Decode(&v); err != nil {
+		return nil, xerrors.Errorf("failed to decode msgpack: %w", err)
+	}
+	if r.Len() > 0 {
+		return nil, xerrors.Errorf("failed to decode msgpack: %d trailing bytes", r.Len())
+	}
+	return v, nil
+}
+
+func (msgpackCodec) Encode(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(fromJSON(v))
+}
@@ -0,0 +1,135 @@
+package codec
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtoTypes is a set of protobuf message types that codecs can be
+// created for.
+type ProtoTypes struct {
+	fds []*desc.FileDescriptor
+	// resolver resolves google.protobuf.Any payloads against all loaded
+	// types, not only against the imports of the decoded message.
+	resolver jsonpb.AnyResolver
+}
+
+// LoadProtoTypes parses the proto files against the import paths and
+// loads the compiled FileDescriptorSets.
+func LoadProtoTypes(protoFiles, importPaths, protosets []string) (*ProtoTypes, error) {
+	var fds []*desc.FileDescriptor
+	if len(protoFiles) > 0 {
+		parser := protoparse.Parser{ImportPaths: importPaths}
+		parsed, err := parser.ParseFiles(protoFiles...)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse proto files: %w", err)
+		}
+		fds = append(fds, parsed...)
+	}
+
+	for _, protoset := range protosets {
+		b, err := os.ReadFile(protoset)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read protoset: %w", err)
+		}
+		var fdSet descriptorpb.FileDescriptorSet
+		if err = proto.Unmarshal(b, &fdSet); err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal protoset (%s): %w", protoset, err)
+		}
+		files, err := desc.CreateFileDescriptorsFromSet(&fdSet)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to load protoset (%s): %w", protoset, err)
+		}
+		for _, fd := range files {
+			fds = append(fds, fd)
+		}
+	}
+	return &ProtoTypes{
+		fds:      fds,
+		resolver: dynamic.AnyResolver(nil, fds...),
+	}, nil
+}
+
+// Codec returns a codec for the given fully qualified message type. Its
+// name is the message type prefixed with "protobuf:".
+func (t *ProtoTypes) Codec(messageType string) (Codec, error) {
+	md := t.findMessage(messageType)
+	if md == nil {
+		return nil, xerrors.Errorf("failed to find the specified type (%s)", messageType)
+	}
+	return protoCodec{md: md, resolver: t.resolver}, nil
+}
+
+// findMessage looks up a message in the loaded files and their transitive
+// dependencies.
+func (t *ProtoTypes) findMessage(name string) *desc.MessageDescriptor {
+	checked := map[*desc.FileDescriptor]bool{}
+	var find func(fd *desc.FileDescriptor) *desc.MessageDescriptor
+	find = func(fd *desc.FileDescriptor) *desc.MessageDescriptor {
+		if checked[fd] {
+			return nil
+		}
+		checked[fd] = true
+		if md := fd.FindMessage(name); md != nil {
+			return md
+		}
+		for _, dep := range fd.GetDependencies() {
+			if md := find(dep); md != nil {
+				return md
+			}
+		}
+		return nil
+	}
+	for _, fd := range t.fds {
+		if md := find(fd); md != nil {
+			return md
+		}
+	}
+	return nil
+}
+
+type protoCodec struct {
+	md       *desc.MessageDescriptor
+	resolver jsonpb.AnyResolver
+}
+
+func (c protoCodec) Name() string {
+	return "protobuf:" + c.md.GetFullyQualifiedName()
+}
+
+// Detect returns false since protobuf messages carry no signature.
+func (c protoCodec) Detect([]byte) bool {
+	return false
+}
+
+func (c protoCodec) Decode(b []byte) (string, error) {
+	m := dynamic.NewMessage(c.md)
+	if err := m.Unmarshal(b); err != nil {
+		return "", xerrors.Errorf("failed to unmarshal message: %w", err)
+	}
+	b, err := m.MarshalJSONPB(&jsonpb.Marshaler{AnyResolver: c.resolver})
+	if err != nil {
+		return "", xerrors.Errorf("failed to marshal message: %w", err)
+	}
+	return string(b), nil
+}
+
+func (c protoCodec) Encode(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := dynamic.NewMessage(c.md)
+	if err = m.UnmarshalJSONPB(&jsonpb.Unmarshaler{AnyResolver: c.resolver}, b); err != nil {
+		return nil, xerrors.Errorf("value does not match %s: %w", c.md.GetFullyQualifiedName(), err)
+	}
+	return m.Marshal()
+}
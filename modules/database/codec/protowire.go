@@ -0,0 +1,229 @@
+package codec
+
+import (
+	"encoding/json"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// wireField is one field of a protobuf message decoded without a schema.
+// Exactly one of the value fields is set, depending on the wire type.
+// Length-delimited fields are shown as a nested message when their payload
+// parses as one, as a string when it is printable text, and as bytes
+// otherwise.
+type wireField struct {
+	Number   protowire.Number `json:"field"`
+	WireType string           `json:"wire_type"`
+	Varint   *wireUint64      `json:"varint,omitempty"`
+	Fixed32  *uint32          `json:"fixed32,omitempty"`
+	Fixed64  *wireUint64      `json:"fixed64,omitempty"`
+	String   *string          `json:"string,omitempty"`
+	Bytes    []byte           `json:"bytes,omitempty"`
+	Message  []wireField      `json:"message,omitempty"`
+	Group    []wireField      `json:"group,omitempty"`
+}
+
+// wireUint64 is a 64-bit field value. It is shown as a JSON string, as in
+// protojson, since JSON numbers above 2^53 lose precision in JavaScript and
+// in the float64 of a generic JSON decoding; negative int64 values are
+// all above 2^63. Both strings and numbers are accepted.
+type wireUint64 uint64
+
+func (v wireUint64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatUint(uint64(v), 10))
+}
+
+func (v *wireUint64) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return xerrors.Errorf("invalid 64-bit field value %s: %w", b, err)
+	}
+	*v = wireUint64(u)
+	return nil
+}
+
+const (
+	wireVarint  = "varint"
+	wireFixed32 = "fixed32"
+	wireFixed64 = "fixed64"
+	wireBytes   = "bytes"
+	wireGroup   = "group"
+)
+
+// ProtoWire shows values as a tree of protobuf fields, for databases whose
+// .proto files are not available.
+var ProtoWire Codec = protoWireCodec{}
+
+type protoWireCodec struct{}
+
+func (protoWireCodec) Name() string {
+	return "protowire"
+}
+
+// Detect returns false since almost any input parses as wire format.
+func (protoWireCodec) Detect([]byte) bool {
+	return false
+}
+
+func (protoWireCodec) Decode(b []byte) (string, error) {
+	fields, err := decodeWire(b)
+	if err != nil {
+		return "", xerrors.Errorf("failed to parse wire format: %w", err)
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (protoWireCodec) Encode(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields []wireField
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, xerrors.Errorf("value is not a list of protobuf fields: %w", err)
+	}
+	return encodeWire(nil, fields)
+}
+
+func decodeWire(b []byte) ([]wireField, error) {
+	fields := []wireField{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := wireField{Number: num}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			w := wireUint64(v)
+			f.WireType, f.Varint, b = wireVarint, &w, b[n:]
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.WireType, f.Fixed32, b = wireFixed32, &v, b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			w := wireUint64(v)
+			f.WireType, f.Fixed64, b = wireFixed64, &w, b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.WireType, b = wireBytes, b[n:]
+			if isPrintable(v) {
+				s := string(v)
+				f.String = &s
+			} else if msg, err := decodeWire(v); err == nil {
+				f.Message = msg
+			} else {
+				f.Bytes = v
+			}
+		case protowire.StartGroupType:
+			v, n := protowire.ConsumeGroup(num, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			group, err := decodeWire(v)
+			if err != nil {
+				return nil, err
+			}
+			f.WireType, f.Group, b = wireGroup, group, b[n:]
+		default:
+			return nil, xerrors.Errorf("unexpected wire type %d for field %d", typ, num)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func encodeWire(b []byte, fields []wireField) ([]byte, error) {
+	for _, f := range fields {
+		if !f.Number.IsValid() {
+			return nil, xerrors.Errorf("invalid field number %d", f.Number)
+		}
+		switch f.WireType {
+		case wireVarint:
+			if f.Varint == nil {
+				return nil, xerrors.Errorf("field %d: missing varint value", f.Number)
+			}
+			b = protowire.AppendTag(b, f.Number, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(*f.Varint))
+		case wireFixed32:
+			if f.Fixed32 == nil {
+				return nil, xerrors.Errorf("field %d: missing fixed32 value", f.Number)
+			}
+			b = protowire.AppendTag(b, f.Number, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, *f.Fixed32)
+		case wireFixed64:
+			if f.Fixed64 == nil {
+				return nil, xerrors.Errorf("field %d: missing fixed64 value", f.Number)
+			}
+			b = protowire.AppendTag(b, f.Number, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, uint64(*f.Fixed64))
+		case wireBytes:
+			v := f.Bytes
+			switch {
+			case f.Message != nil:
+				msg, err := encodeWire(nil, f.Message)
+				if err != nil {
+					return nil, err
+				}
+				v = msg
+			case f.String != nil:
+				v = []byte(*f.String)
+			}
+			b = protowire.AppendTag(b, f.Number, protowire.BytesType)
+			b = protowire.AppendBytes(b, v)
+		case wireGroup:
+			b = protowire.AppendTag(b, f.Number, protowire.StartGroupType)
+			group, err := encodeWire(b, f.Group)
+			if err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(group, f.Number, protowire.EndGroupType)
+		default:
+			return nil, xerrors.Errorf("field %d: unknown wire type %q", f.Number, f.WireType)
+		}
+	}
+	return b, nil
+}
+
+// isPrintable reports whether a length-delimited payload looks like text
+// rather than a nested message.
+func isPrintable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
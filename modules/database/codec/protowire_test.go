@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtoWireRoundTrip(t *testing.T) {
+	nested := protowire.AppendTag(nil, 1, protowire.VarintType)
+	nested = protowire.AppendVarint(nested, 7)
+	nested = protowire.AppendTag(nested, 2, protowire.BytesType)
+	nested = protowire.AppendString(nested, "inner")
+
+	tests := []struct {
+		name   string
+		stored []byte
+		want   string
+	}{
+		{
+			name:   "varint",
+			stored: protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 150),
+			want:   `[{"field":1,"wire_type":"varint","varint":"150"}]`,
+		},
+		{
+			name:   "fixed32",
+			stored: protowire.AppendFixed32(protowire.AppendTag(nil, 2, protowire.Fixed32Type), 0xdeadbeef),
+			want:   `[{"field":2,"wire_type":"fixed32","fixed32":3735928559}]`,
+		},
+		{
+			name:   "fixed64",
+			stored: protowire.AppendFixed64(protowire.AppendTag(nil, 3, protowire.Fixed64Type), 1<<63),
+			want:   `[{"field":3,"wire_type":"fixed64","fixed64":"9223372036854775808"}]`,
+		},
+		{
+			name:   "string",
+			stored: protowire.AppendString(protowire.AppendTag(nil, 4, protowire.BytesType), "hello, world"),
+			want:   `[{"field":4,"wire_type":"bytes","string":"hello, world"}]`,
+		},
+		{
+			name:   "empty string",
+			stored: protowire.AppendString(protowire.AppendTag(nil, 4, protowire.BytesType), ""),
+			want:   `[{"field":4,"wire_type":"bytes","string":""}]`,
+		},
+		{
+			name:   "bytes",
+			stored: protowire.AppendBytes(protowire.AppendTag(nil, 5, protowire.BytesType), []byte{0xff, 0x00}),
+			want:   `[{"field":5,"wire_type":"bytes","bytes":"/wA="}]`,
+		},
+		{
+			name:   "message",
+			stored: protowire.AppendBytes(protowire.AppendTag(nil, 6, protowire.BytesType), nested),
+			want:   `[{"field":6,"wire_type":"bytes","message":[{"field":1,"wire_type":"varint","varint":"7"},{"field":2,"wire_type":"bytes","string":"inner"}]}]`,
+		},
+		{
+			name: "group",
+			stored: protowire.AppendTag(
+				append(protowire.AppendTag(nil, 7, protowire.StartGroupType), nested...),
+				7, protowire.EndGroupType),
+			want: `[{"field":7,"wire_type":"group","group":[{"field":1,"wire_type":"varint","varint":"7"},{"field":2,"wire_type":"bytes","string":"inner"}]}]`,
+		},
+		{
+			name:   "empty",
+			stored: nil,
+			want:   `[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProtoWire.Decode(tt.stored)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() = %s, want %s", got, tt.want)
+			}
+			stored, err := ProtoWire.Encode(decodeRequest(t, got))
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(stored, tt.stored) {
+				t.Errorf("Encode() = %x, want %x", stored, tt.stored)
+			}
+		})
+	}
+}
+
+func TestProtoWireEncode_invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "not a list", value: `{"field":1}`},
+		{name: "field number", value: `[{"field":0,"wire_type":"varint","varint":"1"}]`},
+		{name: "missing value", value: `[{"field":1,"wire_type":"varint"}]`},
+		{name: "wire type", value: `[{"field":1,"wire_type":"float"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ProtoWire.Encode(decodeRequest(t, tt.value)); err == nil {
+				t.Error("Encode() error = nil")
+			}
+		})
+	}
+}
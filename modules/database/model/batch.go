@@ -0,0 +1,41 @@
+package model
+
+// BatchOp is one operation of a batch. Exactly one of its fields is set.
+type BatchOp struct {
+	CreateBucket *BucketsToAdd `json:"create_bucket,omitempty"`
+	Put          *PairsToAdd   `json:"put,omitempty"`
+	Delete       *ItemToDelete `json:"delete,omitempty"`
+	Rename       *ItemToRename `json:"rename,omitempty"`
+	Update       *ItemToUpdate `json:"update,omitempty"`
+}
+
+// BatchReqBody lists operations applied in order, in one transaction.
+type BatchReqBody struct {
+	Operations []BatchOp `json:"operations"`
+}
+
+// BatchOpStatus tells what happened to an operation of a batch.
+type BatchOpStatus string
+
+const (
+	// BatchOpOK operations succeeded, and were rolled back if a later one
+	// failed.
+	BatchOpOK BatchOpStatus = "ok"
+	// BatchOpFailed is the operation that rolled the batch back.
+	BatchOpFailed BatchOpStatus = "failed"
+	// BatchOpNotRun operations come after the failed one.
+	BatchOpNotRun BatchOpStatus = "not_run"
+)
+
+type BatchOpResult struct {
+	Op     string        `json:"op"`
+	Status BatchOpStatus `json:"status"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type BatchResult struct {
+	// Committed is false when an operation failed and the whole batch was
+	// rolled back.
+	Committed bool            `json:"committed"`
+	Results   []BatchOpResult `json:"results"`
+}
@@ -0,0 +1,50 @@
+package model
+
+import "golang.org/x/xerrors"
+
+// ConflictPolicy decides what a copy does with keys that already exist at
+// the destination.
+type ConflictPolicy string
+
+const (
+	// ConflictFail aborts the copy before anything is written. It is the
+	// default.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip keeps the existing keys.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing keys.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// Validate reports an error for unknown policies. The zero value is
+// treated as fail.
+func (p ConflictPolicy) Validate() error {
+	switch p {
+	case "", ConflictFail, ConflictSkip, ConflictOverwrite:
+		return nil
+	}
+	return xerrors.Errorf("unknown conflict policy: %s", p)
+}
+
+// ItemToCopy copies the content of the bucket at LevelStack, or of the
+// whole file when it is empty, into the bucket at NewLevelStack. Missing
+// destination buckets are created. Buckets existing on both sides are
+// merged, and OnConflict applies to the other existing keys.
+type ItemToCopy struct {
+	LevelStack    []string `json:"level_stack"`
+	Encoding      Encoding `json:"encoding,omitempty"`
+	NewLevelStack []string `json:"new_level_stack"`
+	// DestPath is the bolt file to copy into, which is created if needed.
+	// The database being browsed is used when it is empty. It is only set
+	// by the copy command: the API must not write files anywhere the
+	// server can.
+	DestPath   string         `json:"-"`
+	OnConflict ConflictPolicy `json:"on_conflict,omitempty"`
+}
+
+type CopyResult struct {
+	Buckets     int `json:"buckets"`
+	Pairs       int `json:"pairs"`
+	Skipped     int `json:"skipped,omitempty"`
+	Overwritten int `json:"overwritten,omitempty"`
+}
@@ -0,0 +1,27 @@
+package model
+
+// CountReqBody asks for the number of child buckets and pairs of the
+// buckets named in Keys, under LevelStack.
+type CountReqBody struct {
+	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
+	Keys       []string `json:"keys"`
+	// Limit stops counting a bucket after this many entries, 10000 by
+	// default.
+	Limit int `json:"limit,omitempty" validate:"gte=0"`
+}
+
+type BucketCount struct {
+	Name          string `json:"name"`
+	NoOfChildBkts int    `json:"no_of_child_bkts"`
+	NoOfPairs     int    `json:"no_of_pairs"`
+	// Capped is set when the bucket holds more entries than the limit, so
+	// that the counts are lower bounds.
+	Capped bool `json:"capped,omitempty"`
+}
+
+type BucketCounts struct {
+	LevelStack []string      `json:"level_stack"`
+	Encoding   Encoding      `json:"encoding,omitempty"`
+	Counts     []BucketCount `json:"counts"`
+}
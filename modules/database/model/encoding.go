@@ -0,0 +1,63 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+
+	"golang.org/x/xerrors"
+)
+
+// Encoding describes how level stack segments, keys and values are
+// represented in requests and responses. The binary encodings carry the
+// stored bytes as-is, so they round-trip keys that are not valid UTF-8.
+type Encoding string
+
+const (
+	EncodingUTF8   Encoding = "utf8"
+	EncodingHex    Encoding = "hex"
+	EncodingBase64 Encoding = "base64"
+)
+
+// Validate reports an error for unknown encodings. The zero value is
+// treated as utf8.
+func (e Encoding) Validate() error {
+	switch e {
+	case "", EncodingUTF8, EncodingHex, EncodingBase64:
+		return nil
+	}
+	return xerrors.Errorf("unknown encoding: %s", e)
+}
+
+// IsBinary reports whether values are exchanged as raw bytes instead of
+// being decoded for display.
+func (e Encoding) IsBinary() bool {
+	return e == EncodingHex || e == EncodingBase64
+}
+
+func (e Encoding) EncodeToString(b []byte) string {
+	switch e {
+	case EncodingHex:
+		return hex.EncodeToString(b)
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return string(b)
+}
+
+func (e Encoding) DecodeString(s string) ([]byte, error) {
+	switch e {
+	case EncodingHex:
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid hex string %q: %w", s, err)
+		}
+		return b, nil
+	case EncodingBase64:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid base64 string %q: %w", s, err)
+		}
+		return b, nil
+	}
+	return []byte(s), nil
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		enc  Encoding
+		b    []byte
+		want string
+	}{
+		{enc: "", b: []byte("users"), want: "users"},
+		{enc: EncodingUTF8, b: []byte("users"), want: "users"},
+		{enc: EncodingHex, b: []byte{0xff, 0x00, 0x01}, want: "ff0001"},
+		{enc: EncodingBase64, b: []byte{0xff, 0x00, 0x01}, want: "/wAB"},
+		{enc: EncodingHex, b: []byte{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.enc)+" "+tt.want, func(t *testing.T) {
+			if err := tt.enc.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			got := tt.enc.EncodeToString(tt.b)
+			if got != tt.want {
+				t.Errorf("EncodeToString() = %q, want %q", got, tt.want)
+			}
+			b, err := tt.enc.DecodeString(got)
+			if err != nil {
+				t.Fatalf("DecodeString() error = %v", err)
+			}
+			if !bytes.Equal(b, tt.b) {
+				t.Errorf("DecodeString() = %x, want %x", b, tt.b)
+			}
+		})
+	}
+}
+
+func TestEncoding_invalid(t *testing.T) {
+	if err := Encoding("base32").Validate(); err == nil {
+		t.Error("Validate() error = nil for an unknown encoding")
+	}
+	if _, err := EncodingHex.DecodeString("zz"); err == nil {
+		t.Error("DecodeString() error = nil for invalid hex")
+	}
+	if _, err := EncodingBase64.DecodeString("!!"); err == nil {
+		t.Error("DecodeString() error = nil for invalid base64")
+	}
+}
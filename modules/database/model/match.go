@@ -0,0 +1,81 @@
+package model
+
+import "golang.org/x/xerrors"
+
+// MatchMode selects how ListElemReqBody.SearchKey is matched against keys.
+type MatchMode string
+
+const (
+	// MatchSubstring matches keys containing the search key, ignoring case.
+	// It is the default.
+	MatchSubstring MatchMode = "substring"
+	// MatchPrefix matches keys starting with the search key.
+	MatchPrefix MatchMode = "prefix"
+	// MatchRange matches keys from the search key, inclusive, to SearchTo,
+	// exclusive. An empty bound leaves that side of the range open.
+	MatchRange MatchMode = "range"
+	// MatchExact matches the search key only.
+	MatchExact MatchMode = "exact"
+	// MatchGlob matches keys against a shell pattern with the syntax of
+	// path.Match, except that '*' and '?' also match '/'.
+	MatchGlob MatchMode = "glob"
+	// MatchRegex matches keys against a regular expression.
+	MatchRegex MatchMode = "regex"
+)
+
+// Validate reports an error for unknown match modes. The zero value is
+// treated as substring.
+func (m MatchMode) Validate() error {
+	switch m {
+	case "", MatchSubstring, MatchPrefix, MatchRange, MatchExact, MatchGlob, MatchRegex:
+		return nil
+	}
+	return xerrors.Errorf("unknown match mode: %s", m)
+}
+
+// ValueMatchMode selects how ValueSearch.Term is matched against values.
+type ValueMatchMode string
+
+const (
+	// ValueMatchSubstring matches values containing the term, ignoring
+	// case. It is the default.
+	ValueMatchSubstring ValueMatchMode = "substring"
+	// ValueMatchRegex matches values against a regular expression.
+	ValueMatchRegex ValueMatchMode = "regex"
+	// ValueMatchField matches JSON values whose field at Path equals the
+	// term, read as a JSON literal. Terms that are not valid JSON are
+	// compared as strings.
+	ValueMatchField ValueMatchMode = "field"
+)
+
+// ValueSearch filters a listing on the decoded values of its keys.
+type ValueSearch struct {
+	Mode ValueMatchMode `json:"mode,omitempty"`
+	Term string         `json:"term"`
+	// Path is the dot-separated field path of ValueMatchField, where
+	// numbers index arrays (e.g. "user.emails.0").
+	Path string `json:"path,omitempty"`
+}
+
+// Validate reports an error for unknown modes and field searches without
+// a path.
+func (s ValueSearch) Validate() error {
+	switch s.Mode {
+	case "", ValueMatchSubstring, ValueMatchRegex:
+		return nil
+	case ValueMatchField:
+		if s.Path == "" {
+			return xerrors.New("field value search requires a path")
+		}
+		return nil
+	}
+	return xerrors.Errorf("unknown value match mode: %s", s.Mode)
+}
+
+// Excerpt is the part of a value that matched a ValueSearch, with some
+// surrounding text.
+type Excerpt struct {
+	Before string `json:"before,omitempty"`
+	Match  string `json:"match"`
+	After  string `json:"after,omitempty"`
+}
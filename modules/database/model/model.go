@@ -2,40 +2,90 @@ package model
 
 type ListElemReqBody struct {
 	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
 	PageSize   int64    `validate:"gte=0,max=1000"`
-	Page       int64    `validate:"gte=0"`
-	SearchKey  string
+	// NextKey is the opaque token returned by the previous page.
+	// An empty value starts from the first key of the bucket.
+	NextKey   string
+	SearchKey string
+	MatchMode MatchMode
+	// SearchTo is the exclusive upper bound of MatchRange.
+	SearchTo string
+	// ValueSearch, when set, only lists the keys whose decoded value
+	// matches.
+	ValueSearch *ValueSearch `json:"value_search,omitempty"`
 }
 
 type ListedElem struct {
-	LevelStack   []string `json:"level_stack"`
-	SearchKey    string   `json:"search_key,omitempty"`
-	ExceedsLimit bool     `json:"exceeds_limit"`
-	Results      []Result `json:"results"`
+	LevelStack  []string     `json:"level_stack"`
+	Encoding    Encoding     `json:"encoding,omitempty"`
+	SearchKey   string       `json:"search_key,omitempty"`
+	MatchMode   MatchMode    `json:"match_mode,omitempty"`
+	ValueSearch *ValueSearch `json:"value_search,omitempty"`
+	// NextKey is set when more results are available. Pass it back as
+	// the next_key query parameter to fetch the following page.
+	NextKey string   `json:"next_key,omitempty"`
+	Results []Result `json:"results"`
+}
+
+// ListTrailer ends a streamed listing that stopped before the end of the
+// bucket, either at the page size or on an error.
+type ListTrailer struct {
+	NextKey string `json:"next_key,omitempty"`
+	Error   string `json:"error,omitempty"`
 }
 
 type Result struct {
-	Name          string   `json:"name"`
-	IsBucket      bool     `json:"is_bucket"`
-	Value         string   `json:"value,omitempty"`
-	NoOfChildBkts int      `json:"no_of_child_bkts,omitempty"`
-	NoOfPairs     int      `json:"no_of_pairs,omitempty"`
-	ChildBkts     []string `json:"child_bkts,omitempty"`
-	ChildKeys     []string `json:"child_keys,omitempty"`
+	Name        string   `json:"name"`
+	IsBucket    bool     `json:"is_bucket"`
+	Value       string   `json:"value,omitempty"`
+	Codec       string   `json:"codec,omitempty"`
+	Compression string   `json:"compression,omitempty"`
+	Encrypted   bool     `json:"encrypted,omitempty"`
+	KeyCodec    string   `json:"key_codec,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Excerpt     *Excerpt `json:"excerpt,omitempty"`
+	ChildBkts   []string `json:"child_bkts,omitempty"`
+	ChildKeys   []string `json:"child_keys,omitempty"`
+}
+
+type ItemToGet struct {
+	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
+	Key        string   `json:"key"`
+}
+
+type FetchedElem struct {
+	LevelStack  []string `json:"level_stack"`
+	Encoding    Encoding `json:"encoding,omitempty"`
+	Key         string   `json:"key"`
+	IsBucket    bool     `json:"is_bucket"`
+	Value       string   `json:"value,omitempty"`
+	Codec       string   `json:"codec,omitempty"`
+	Compression string   `json:"compression,omitempty"`
+	Encrypted   bool     `json:"encrypted,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	// Size is the length of the stored value in bytes, before decoding.
+	Size int `json:"size"`
 }
 
 type ItemToDelete struct {
 	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
 	Key        string   `json:"key"`
+	// IfMatch, when set, is the version the value must still have.
+	IfMatch string `json:"if_match,omitempty"`
 }
 
 type PairsToAdd struct {
 	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
 	Pairs      []Pair   `json:"pairs"`
 }
 
 type BucketsToAdd struct {
 	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
 	Buckets    []string `json:"buckets"`
 }
 
@@ -46,12 +96,21 @@ type Pair struct {
 
 type ItemToUpdate struct {
 	LevelStack []string    `json:"level_stack"`
+	Encoding   Encoding    `json:"encoding,omitempty"`
 	Key        string      `json:"key"`
 	NewValue   interface{} `json:"new_value,omitempty"`
+	// IfMatch, when set, is the version the value must still have.
+	IfMatch string `json:"if_match,omitempty"`
 }
 
+// ItemToRename renames a key or a bucket, and moves it under
+// NewLevelStack when that is set. An empty NewKey keeps the name.
 type ItemToRename struct {
-	LevelStack []string `json:"level_stack"`
-	Key        string   `json:"key"`
-	NewKey     string   `json:"new_key,omitempty"`
+	LevelStack    []string `json:"level_stack"`
+	Encoding      Encoding `json:"encoding,omitempty"`
+	Key           string   `json:"key"`
+	NewKey        string   `json:"new_key,omitempty"`
+	NewLevelStack []string `json:"new_level_stack,omitempty"`
+	// IfMatch, when set, is the version the value must still have.
+	IfMatch string `json:"if_match,omitempty"`
 }
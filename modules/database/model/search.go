@@ -0,0 +1,42 @@
+package model
+
+// SearchReqBody searches every bucket nested under LevelStack, or the whole
+// file when it is empty. Keys are matched as in ListElemReqBody.
+type SearchReqBody struct {
+	LevelStack  []string     `json:"level_stack"`
+	Encoding    Encoding     `json:"encoding,omitempty"`
+	SearchKey   string       `json:"search_key,omitempty"`
+	MatchMode   MatchMode    `json:"match_mode,omitempty"`
+	SearchTo    string       `json:"search_to,omitempty"`
+	ValueSearch *ValueSearch `json:"value_search,omitempty"`
+	// MaxResults caps the number of matches, up to 1000.
+	MaxResults int `json:"max_results,omitempty" validate:"gte=0,max=1000"`
+	// TimeoutMS is the time budget of the search in milliseconds, 10
+	// seconds by default and one minute at most.
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+}
+
+// SearchMatch is a key found by a search, with the level stack of the
+// bucket holding it.
+type SearchMatch struct {
+	LevelStack []string `json:"level_stack"`
+	Result
+}
+
+// SearchSummary closes a search and tells why it stopped early, if it did.
+type SearchSummary struct {
+	Matches int `json:"matches"`
+	// Buckets is the number of buckets searched.
+	Buckets   int  `json:"buckets"`
+	Truncated bool `json:"truncated,omitempty"`
+	TimedOut  bool `json:"timed_out,omitempty"`
+}
+
+// SearchEvent is one line of the search response: a match while the
+// search runs, then the summary, or an error if the search failed after
+// reporting matches.
+type SearchEvent struct {
+	Match   *SearchMatch   `json:"match,omitempty"`
+	Summary *SearchSummary `json:"summary,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
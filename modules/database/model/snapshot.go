@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// SnapshotInfo describes the copy of the database browsed in snapshot mode.
+type SnapshotInfo struct {
+	Source  string    `json:"source"`
+	TakenAt time.Time `json:"taken_at"`
+	TxID    int       `json:"tx_id"`
+	Size    int64     `json:"size"`
+}
@@ -0,0 +1,65 @@
+package model
+
+// StatsReqBody asks for the statistics of the bucket at LevelStack, or of
+// all the buckets when it is empty.
+type StatsReqBody struct {
+	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
+}
+
+// Stats describes the database file and the space used by a bucket.
+type Stats struct {
+	LevelStack []string `json:"level_stack"`
+	// FileSize is the size of the file on disk, the source file in
+	// snapshot mode, and Size the size of the data as seen by the last
+	// transaction.
+	FileSize int64   `json:"file_size"`
+	Size     int64   `json:"size"`
+	PageSize int     `json:"page_size"`
+	TxID     int     `json:"tx_id"`
+	DB       DBStats `json:"db"`
+	// Bucket aggregates the bucket at LevelStack with all its nested
+	// buckets.
+	Bucket BucketStats `json:"bucket"`
+	// Children are the buckets directly under LevelStack, each aggregated
+	// with its nested buckets.
+	Children []NamedBucketStats `json:"children"`
+	// ChildrenTruncated tells that Children was cut at 1000 buckets.
+	ChildrenTruncated bool `json:"children_truncated,omitempty"`
+}
+
+// DBStats is the state of the freelist and of the read transactions of
+// this process. FreeAlloc and FreelistInuse are updated when a write
+// transaction commits, and the free pages are not counted when the file is
+// opened read-only.
+type DBStats struct {
+	FreePageN     int `json:"free_page_n"`
+	PendingPageN  int `json:"pending_page_n"`
+	FreeAlloc     int `json:"free_alloc"`
+	FreelistInuse int `json:"freelist_inuse"`
+	TxN           int `json:"tx_n"`
+	OpenTxN       int `json:"open_tx_n"`
+}
+
+// BucketStats mirrors the page and key counts of bbolt.BucketStats.
+type BucketStats struct {
+	BranchPageN       int `json:"branch_page_n"`
+	BranchOverflowN   int `json:"branch_overflow_n"`
+	LeafPageN         int `json:"leaf_page_n"`
+	LeafOverflowN     int `json:"leaf_overflow_n"`
+	KeyN              int `json:"key_n"`
+	Depth             int `json:"depth"`
+	BranchAlloc       int `json:"branch_alloc"`
+	BranchInuse       int `json:"branch_inuse"`
+	LeafAlloc         int `json:"leaf_alloc"`
+	LeafInuse         int `json:"leaf_inuse"`
+	BucketN           int `json:"bucket_n"`
+	InlineBucketN     int `json:"inline_bucket_n"`
+	InlineBucketInuse int `json:"inline_bucket_inuse"`
+}
+
+type NamedBucketStats struct {
+	Name     string `json:"name"`
+	KeyCodec string `json:"key_codec,omitempty"`
+	BucketStats
+}
@@ -0,0 +1,32 @@
+package model
+
+// WatchReqBody watches the keys of the bucket at LevelStack, or of the root
+// when it is empty. Nested buckets are reported, but not their content.
+type WatchReqBody struct {
+	LevelStack []string `json:"level_stack"`
+	Encoding   Encoding `json:"encoding,omitempty"`
+}
+
+// WatchEventType is the kind of a WatchEvent, and the name of its
+// Server-Sent Event.
+type WatchEventType string
+
+const (
+	// WatchReady is sent once the watch started, before any change.
+	WatchReady WatchEventType = "ready"
+	WatchAdded WatchEventType = "added"
+	// WatchRemoved events only carry the name of the key.
+	WatchRemoved WatchEventType = "removed"
+	WatchChanged WatchEventType = "changed"
+	// WatchStale is sent in snapshot mode when the source file changed
+	// since the snapshot was taken. POST /snapshot/refresh takes a new one.
+	WatchStale WatchEventType = "stale"
+)
+
+// WatchEvent is a change of a watched bucket, seen in the transaction
+// TxID.
+type WatchEvent struct {
+	Type WatchEventType `json:"type"`
+	TxID int            `json:"tx_id"`
+	*Result
+}
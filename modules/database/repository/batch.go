@@ -0,0 +1,108 @@
+package repository
+
+import (
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// Batch applies the operations in order within a single read-write
+// transaction. If any of them fails, none of them is applied, and the
+// error of the failed operation is returned along with the results.
+func (r *Repository) Batch(input model.BatchReqBody) (result model.BatchResult, err error) {
+	result.Results = make([]model.BatchOpResult, len(input.Operations))
+	for i, op := range input.Operations {
+		result.Results[i] = model.BatchOpResult{Op: batchOpName(op), Status: model.BatchOpNotRun}
+	}
+	err = r.update(func(tx *bolt.Tx) error {
+		for i, op := range input.Operations {
+			if err := r.applyBatchOp(tx, op); err != nil {
+				result.Results[i].Status = model.BatchOpFailed
+				result.Results[i].Error = err.Error()
+				return xerrors.Errorf("operation %d (%s) failed: %w", i, result.Results[i].Op, err)
+			}
+			result.Results[i].Status = model.BatchOpOK
+		}
+		return nil
+	})
+	result.Committed = err == nil
+	return result, err
+}
+
+// batchOpName returns the name of the field set in op, or an empty string
+// unless exactly one is set.
+func batchOpName(op model.BatchOp) string {
+	name := ""
+	for _, field := range []struct {
+		set  bool
+		name string
+	}{
+		{op.CreateBucket != nil, "create_bucket"},
+		{op.Put != nil, "put"},
+		{op.Delete != nil, "delete"},
+		{op.Rename != nil, "rename"},
+		{op.Update != nil, "update"},
+	} {
+		if field.set && name != "" {
+			return ""
+		} else if field.set {
+			name = field.name
+		}
+	}
+	return name
+}
+
+// validateBatchOp fails with ErrInvalid when op sets no operation or
+// several, or misses a key.
+func validateBatchOp(op model.BatchOp) error {
+	var (
+		enc  model.Encoding
+		keys []string
+	)
+	name := batchOpName(op)
+	switch name {
+	case "create_bucket":
+		enc, keys = op.CreateBucket.Encoding, op.CreateBucket.Buckets
+	case "put":
+		enc = op.Put.Encoding
+		for _, pair := range op.Put.Pairs {
+			keys = append(keys, pair.Key)
+		}
+	case "delete":
+		enc, keys = op.Delete.Encoding, []string{op.Delete.Key}
+	case "rename":
+		enc, keys = op.Rename.Encoding, []string{op.Rename.Key}
+	case "update":
+		enc, keys = op.Update.Encoding, []string{op.Update.Key}
+	default:
+		return xerrors.Errorf("Each operation must set exactly one of create_bucket, put, delete, rename or update: %w", ErrInvalid)
+	}
+	if err := enc.Validate(); err != nil {
+		return xerrors.Errorf("%v: %w", err, ErrInvalid)
+	}
+	for _, key := range keys {
+		if key == "" {
+			return xerrors.Errorf("%s requires a key: %w", name, ErrInvalid)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) applyBatchOp(tx *bolt.Tx, op model.BatchOp) error {
+	if err := validateBatchOp(op); err != nil {
+		return err
+	}
+	switch batchOpName(op) {
+	case "create_bucket":
+		return r.addBuckets(tx, *op.CreateBucket)
+	case "put":
+		return r.addPairs(tx, *op.Put)
+	case "delete":
+		return r.deleteElement(tx, *op.Delete)
+	case "rename":
+		return r.renameElement(tx, *op.Rename)
+	default:
+		return r.updatePairValue(tx, *op.Update)
+	}
+}
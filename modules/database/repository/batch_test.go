@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestBatch(t *testing.T) {
+	fill := func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "users")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("alice"), []byte("1"))
+	}
+	before := []string{"users/", "users/alice=1"}
+	put := func(key string) model.BatchOp {
+		return model.BatchOp{Put: &model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: key, Value: "2"}}}}
+	}
+
+	tests := []struct {
+		name       string
+		ops        []model.BatchOp
+		want       []string
+		wantStatus []model.BatchOpStatus
+		wantErr    error
+	}{
+		{
+			name: "committed",
+			ops: []model.BatchOp{
+				{CreateBucket: &model.BucketsToAdd{LevelStack: []string{"users"}, Buckets: []string{"archived"}}},
+				{Rename: &model.ItemToRename{LevelStack: []string{"users"}, Key: "alice", NewLevelStack: []string{"users", "archived"}}},
+				put("bob"),
+			},
+			want:       []string{"users/", "users/archived/", "users/archived/alice=1", `users/bob="2"`},
+			wantStatus: []model.BatchOpStatus{model.BatchOpOK, model.BatchOpOK, model.BatchOpOK},
+		},
+		{
+			name: "rolled back",
+			ops: []model.BatchOp{
+				put("bob"),
+				{Delete: &model.ItemToDelete{LevelStack: []string{"users"}, Key: "alice"}},
+				{Update: &model.ItemToUpdate{LevelStack: []string{"groups"}, Key: "admins", NewValue: "3"}},
+				put("carol"),
+			},
+			want:       before,
+			wantStatus: []model.BatchOpStatus{model.BatchOpOK, model.BatchOpOK, model.BatchOpFailed, model.BatchOpNotRun},
+			wantErr:    ErrNotFound,
+		},
+		{
+			name: "conflict",
+			ops: []model.BatchOp{
+				put("bob"),
+				{Delete: &model.ItemToDelete{LevelStack: []string{"users"}, Key: "alice", IfMatch: versionOf([]byte("0"))}},
+			},
+			want:       before,
+			wantStatus: []model.BatchOpStatus{model.BatchOpOK, model.BatchOpFailed},
+			wantErr:    ErrConflict,
+		},
+		{
+			name:       "unknown operation",
+			ops:        []model.BatchOp{put("bob"), {}},
+			want:       before,
+			wantStatus: []model.BatchOpStatus{model.BatchOpOK, model.BatchOpFailed},
+			wantErr:    ErrInvalid,
+		},
+		{
+			name: "several operations",
+			ops: []model.BatchOp{{
+				Put:    &model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: "bob", Value: "2"}}},
+				Delete: &model.ItemToDelete{LevelStack: []string{"users"}, Key: "alice"},
+			}},
+			want:       before,
+			wantStatus: []model.BatchOpStatus{model.BatchOpFailed},
+			wantErr:    ErrInvalid,
+		},
+		{
+			name:       "missing key",
+			ops:        []model.BatchOp{put("bob"), put("")},
+			want:       before,
+			wantStatus: []model.BatchOpStatus{model.BatchOpOK, model.BatchOpFailed},
+			wantErr:    ErrInvalid,
+		},
+		{
+			name:       "unknown encoding",
+			ops:        []model.BatchOp{{Delete: &model.ItemToDelete{LevelStack: []string{"users"}, Encoding: "base32", Key: "alice"}}},
+			want:       before,
+			wantStatus: []model.BatchOpStatus{model.BatchOpFailed},
+			wantErr:    ErrInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepository(t, Options{}, fill)
+			result, err := r.Batch(model.BatchReqBody{Operations: tt.ops})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Batch() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Batch() error = %v", err)
+			}
+			if result.Committed != (tt.wantErr == nil) {
+				t.Errorf("Committed = %v, want %v", result.Committed, tt.wantErr == nil)
+			}
+			var status []model.BatchOpStatus
+			for _, res := range result.Results {
+				status = append(status, res.Status)
+			}
+			if !reflect.DeepEqual(status, tt.wantStatus) {
+				t.Errorf("statuses = %v, want %v", status, tt.wantStatus)
+			}
+
+			var got []string
+			err = r.view(func(tx *bolt.Tx) error {
+				got = plainEntries(tx.Cursor(), tx.Bucket, "")
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
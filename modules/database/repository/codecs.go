@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/codec"
+)
+
+// newRegistry registers the codecs given in opts and maps them to buckets.
+// Codec mappings come first, then proto mappings, then the catch-all proto
+// type and wire format decoding.
+func newRegistry(opts Options) (*codec.Registry, error) {
+	registry := codec.NewRegistry()
+	for _, c := range opts.Codecs {
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range opts.CodecMappings {
+		pattern, name, err := codec.ParseMapping(m)
+		if err != nil {
+			return nil, err
+		}
+		if err = registry.Map(pattern, name); err != nil {
+			return nil, err
+		}
+	}
+
+	var protoMappings [][2]string
+	for _, m := range opts.ProtoMappings {
+		pattern, typ, err := codec.ParseMapping(m)
+		if err != nil {
+			return nil, err
+		}
+		protoMappings = append(protoMappings, [2]string{pattern, typ})
+	}
+	if opts.ProtoType != "" {
+		protoMappings = append(protoMappings, [2]string{"**", opts.ProtoType})
+	}
+
+	if len(opts.ProtoFiles) == 0 && len(opts.Protosets) == 0 {
+		if len(opts.ProtoMappings) > 0 {
+			return nil, xerrors.New("proto mappings require proto files or protosets")
+		}
+	} else if len(protoMappings) > 0 {
+		types, err := codec.LoadProtoTypes(opts.ProtoFiles, opts.ProtoImportPaths, opts.Protosets)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range protoMappings {
+			c, err := types.Codec(m[1])
+			if err != nil {
+				return nil, err
+			}
+			// The same type may be mapped to several buckets.
+			if _, ok := registry.Lookup(c.Name()); !ok {
+				if err = registry.Register(c); err != nil {
+					return nil, err
+				}
+			}
+			if err = registry.Map(m[0], c.Name()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if opts.ProtoWire {
+		if err := registry.Map("**", codec.ProtoWire.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range opts.CompressionMappings {
+		pattern, name, err := codec.ParseMapping(m)
+		if err != nil {
+			return nil, err
+		}
+		if err = registry.MapCompression(pattern, name); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range opts.KeyMappings {
+		pattern, name, err := codec.ParseMapping(m)
+		if err != nil {
+			return nil, err
+		}
+		if err = registry.MapKey(pattern, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.EncryptionKeyFile != "" {
+		if len(opts.EncryptionPatterns) == 0 {
+			return nil, xerrors.New("an encryption key requires bucket patterns to apply to")
+		}
+		key, err := codec.LoadKeyFile(opts.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		layout := codec.NonceLayout(opts.EncryptionNonce)
+		if layout == "" {
+			layout = codec.NoncePrefix
+		}
+		c, err := codec.NewAESGCM(key, layout)
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range opts.EncryptionPatterns {
+			registry.MapCipher(pattern, c)
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+const (
+	// copyBatchSize and copyBatchBytes bound the entries written by each
+	// transaction of a copy.
+	copyBatchSize  = 1000
+	copyBatchBytes = 4 << 20
+)
+
+// copyEntry is a bucket or a pair read from the source of a copy.
+type copyEntry struct {
+	// path leads from the copied bucket to the entry, ending with its key.
+	path [][]byte
+	// value is nil for buckets.
+	value    []byte
+	sequence uint64
+}
+
+// Copy copies a bucket subtree, including the bucket sequences, into
+// another bucket of this file or of another bolt file. Each transaction
+// copies a bounded batch of entries, so a large copy does not hold a single
+// huge transaction, and a failed copy may leave the batches already
+// written. With the fail policy, conflicts are looked for before writing.
+func (r *Repository) Copy(input model.ItemToCopy) (result model.CopyResult, err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return result, err
+	}
+	if err = input.OnConflict.Validate(); err != nil {
+		return result, err
+	}
+	src, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return result, err
+	}
+	dst, err := r.resolvePath(input.Encoding, input.NewLevelStack)
+	if err != nil {
+		return result, err
+	}
+
+	destView, destUpdate := r.view, r.update
+	if input.DestPath != "" {
+		destDB, err := bolt.Open(input.DestPath, 0600, &bolt.Options{Timeout: r.lockTimeout})
+		if err != nil {
+			return result, xerrors.Errorf("failed to open %s: %w", input.DestPath, err)
+		}
+		defer destDB.Close()
+		destView, destUpdate = destDB.View, destDB.Update
+	} else if len(src.raw) == 0 || isWithin(dst, bucketPath{raw: src.raw[:len(src.raw)-1]}, src.raw[len(src.raw)-1]) {
+		return result, errors.New("A bucket cannot be copied into itself")
+	} else if len(dst.raw) <= len(src.raw) && samePath(dst, bucketPath{raw: src.raw[:len(dst.raw)]}) {
+		// The batches would be written into the subtree being read.
+		return result, errors.New("A bucket cannot be copied into a bucket containing it")
+	}
+
+	var sequence uint64
+	err = r.view(func(tx *bolt.Tx) error {
+		if len(src.raw) == 0 {
+			return nil
+		}
+		srcBkt, err := findBucket(tx, src)
+		if err != nil {
+			return err
+		}
+		sequence = srcBkt.Sequence()
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if input.OnConflict == "" || input.OnConflict == model.ConflictFail {
+		err = eachCopyBatch(r.view, src, func(entries []copyEntry) error {
+			return destView(func(tx *bolt.Tx) error {
+				return checkCopyBatch(tx, dst, entries)
+			})
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = destUpdate(func(tx *bolt.Tx) error {
+		return createPath(tx, dst, sequence, input.OnConflict)
+	})
+	if err != nil {
+		return result, errors.Wrapf(err, "Unable to create bucket %s", strings.Join(input.NewLevelStack, "/"))
+	}
+	err = eachCopyBatch(r.view, src, func(entries []copyEntry) error {
+		return destUpdate(func(tx *bolt.Tx) error {
+			return applyCopyBatch(tx, dst, entries, input.OnConflict, &result)
+		})
+	})
+	return result, err
+}
+
+// eachCopyBatch reads the subtree at src in batches and passes them to fn.
+// Every batch is read in its own transaction, resuming after the last
+// entry of the previous one, so that fn can write to the same file.
+func eachCopyBatch(view func(func(*bolt.Tx) error) error, src bucketPath, fn func([]copyEntry) error) error {
+	var after [][]byte
+	for {
+		var entries []copyEntry
+		err := view(func(tx *bolt.Tx) error {
+			c := tx.Cursor()
+			if len(src.raw) > 0 {
+				srcBkt, err := findBucket(tx, src)
+				if err != nil {
+					return err
+				}
+				c = srcBkt.Cursor()
+			}
+			size := 0
+			readCopyEntries(c, nil, after, &entries, &size)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if err = fn(entries); err != nil {
+			return err
+		}
+		after = entries[len(entries)-1].path
+	}
+}
+
+// readCopyEntries appends the entries under c in depth-first order, each
+// bucket before its content, starting after the entry at path after. It
+// reports whether it stopped because the batch is full.
+func readCopyEntries(c *bolt.Cursor, prefix, after [][]byte, entries *[]copyEntry, size *int) bool {
+	k, v := c.First()
+	if len(after) > 0 {
+		k, v = c.Seek(after[0])
+	}
+	for ; k != nil; k, v = c.Next() {
+		resumed := len(after) > 0 && bytes.Equal(k, after[0])
+		path := append(prefix[:len(prefix):len(prefix)], bytes.Clone(k))
+		if !resumed {
+			if len(*entries) == copyBatchSize || *size >= copyBatchBytes {
+				return true
+			}
+			entry := copyEntry{path: path}
+			if v == nil {
+				entry.sequence = c.Bucket().Bucket(k).Sequence()
+			} else {
+				entry.value = bytes.Clone(v)
+			}
+			*entries = append(*entries, entry)
+			*size += len(k) + len(v)
+		}
+		if v == nil {
+			var childAfter [][]byte
+			if resumed {
+				childAfter = after[1:]
+			}
+			if readCopyEntries(c.Bucket().Bucket(k).Cursor(), path, childAfter, entries, size) {
+				return true
+			}
+		}
+		after = nil
+	}
+	return false
+}
+
+// createPath creates the missing buckets of path, and gives the last one
+// the sequence of the copied bucket when it is new or overwritten.
+func createPath(tx *bolt.Tx, path bucketPath, sequence uint64, policy model.ConflictPolicy) error {
+	if len(path.raw) == 0 {
+		return nil
+	}
+	var parent bucketParent = tx
+	for i, name := range path.raw {
+		b := parent.Bucket(name)
+		if b == nil {
+			var err error
+			if b, err = parent.CreateBucket(name); err != nil {
+				return err
+			}
+			if i == len(path.raw)-1 {
+				return b.SetSequence(sequence)
+			}
+		} else if i == len(path.raw)-1 && policy == model.ConflictOverwrite {
+			return b.SetSequence(sequence)
+		}
+		parent = b
+	}
+	return nil
+}
+
+// copyTarget returns the destination parent of an entry, and the bucket
+// and value already stored under its key. A nil parent means that the
+// entry is under a bucket that was not copied.
+func copyTarget(root bucketParent, entry copyEntry) (parent bucketParent, bkt *bolt.Bucket, val []byte) {
+	parent = root
+	for _, name := range entry.path[:len(entry.path)-1] {
+		b := parent.Bucket(name)
+		if b == nil {
+			return nil, nil, nil
+		}
+		parent = b
+	}
+	key := entry.path[len(entry.path)-1]
+	if b, ok := parent.(*bolt.Bucket); ok {
+		val = b.Get(key)
+	}
+	return parent, parent.Bucket(key), val
+}
+
+// conflicts reports whether an entry cannot be written over what is stored
+// under its key. Buckets are merged into existing buckets.
+func conflicts(entry copyEntry, bkt *bolt.Bucket, val []byte) bool {
+	if entry.value == nil {
+		return val != nil
+	}
+	return bkt != nil || val != nil
+}
+
+func copyConflictError(dst bucketPath, entry copyEntry) error {
+	names := make([]string, len(entry.path))
+	for i, name := range entry.path {
+		names[i] = fmt.Sprintf("%q", name)
+	}
+	return errors.Errorf("%s already exists under stack %s", strings.Join(names, "/"), dst.stack)
+}
+
+func checkCopyBatch(tx *bolt.Tx, dst bucketPath, entries []copyEntry) error {
+	root, err := findParent(tx, dst)
+	if xerrors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		parent, bkt, val := copyTarget(root, entry)
+		if parent != nil && conflicts(entry, bkt, val) {
+			return copyConflictError(dst, entry)
+		}
+	}
+	return nil
+}
+
+func applyCopyBatch(tx *bolt.Tx, dst bucketPath, entries []copyEntry, policy model.ConflictPolicy, result *model.CopyResult) error {
+	root, err := findParent(tx, dst)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		parent, bkt, val := copyTarget(root, entry)
+		if parent == nil {
+			result.Skipped++
+			continue
+		}
+		key := entry.path[len(entry.path)-1]
+		if conflicts(entry, bkt, val) {
+			switch policy {
+			case model.ConflictSkip:
+				result.Skipped++
+				continue
+			case model.ConflictOverwrite:
+				if bkt != nil {
+					err = parent.DeleteBucket(key)
+				} else {
+					err = parent.(*bolt.Bucket).Delete(key)
+				}
+				if err != nil {
+					return err
+				}
+				bkt = nil
+				result.Overwritten++
+			default:
+				return copyConflictError(dst, entry)
+			}
+		}
+
+		if entry.value == nil {
+			if bkt == nil {
+				if bkt, err = parent.CreateBucket(key); err != nil {
+					return err
+				}
+				if err = bkt.SetSequence(entry.sequence); err != nil {
+					return err
+				}
+			} else if policy == model.ConflictOverwrite {
+				if err = bkt.SetSequence(entry.sequence); err != nil {
+					return err
+				}
+			}
+			result.Buckets++
+			continue
+		}
+		b, ok := parent.(*bolt.Bucket)
+		if !ok {
+			return errors.New("Pairs cannot be copied to the root, please provide new level stack")
+		}
+		if err = b.Put(key, entry.value); err != nil {
+			return err
+		}
+		result.Pairs++
+	}
+	return nil
+}
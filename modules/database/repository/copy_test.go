@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestCopy_selfOverlap(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "z", "moved", "inner")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	})
+
+	tests := []struct {
+		name    string
+		from    []string
+		to      []string
+		wantErr bool
+	}{
+		{name: "into itself", from: []string{"z", "moved"}, to: []string{"z", "moved"}, wantErr: true},
+		{name: "into a child", from: []string{"z"}, to: []string{"z", "moved"}, wantErr: true},
+		{name: "into the parent", from: []string{"z", "moved"}, to: []string{"z"}, wantErr: true},
+		{name: "into the root", from: []string{"z", "moved"}, wantErr: true},
+		{name: "the root", to: []string{"copy"}, wantErr: true},
+		{name: "into a sibling", from: []string{"z", "moved"}, to: []string{"copy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Copy(model.ItemToCopy{LevelStack: tt.from, NewLevelStack: tt.to})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Copy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// putKeys puts n keys named prefix0000, prefix0001... into b.
+func putKeys(b *bolt.Bucket, prefix string, n int, value []byte) error {
+	for i := 0; i < n; i++ {
+		if err := b.Put([]byte(fmt.Sprintf("%s%04d", prefix, i)), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeEntries lists the entries under c depth-first, each bucket before
+// its content, as the batches of a copy read them.
+func treeEntries(c *bolt.Cursor, bucket func([]byte) *bolt.Bucket, prefix string) []string {
+	var entries []string
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			entries = append(entries, fmt.Sprintf("%s%s=%x", prefix, k, v))
+			continue
+		}
+		b := bucket(k)
+		entries = append(entries, fmt.Sprintf("%s%s/ #%d", prefix, k, b.Sequence()))
+		entries = append(entries, treeEntries(b.Cursor(), b.Bucket, fmt.Sprintf("%s%s/", prefix, k))...)
+	}
+	return entries
+}
+
+func bucketEntries(t *testing.T, r *Repository, name string) (entries []string) {
+	t.Helper()
+	err := r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(name))
+		entries = treeEntries(b.Cursor(), b.Bucket, "")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestCopy_batches(t *testing.T) {
+	tests := []struct {
+		name string
+		// fill fills the copied bucket.
+		fill        func(b *bolt.Bucket) error
+		wantBatches []int
+	}{
+		{
+			name:        "one full batch",
+			fill:        func(b *bolt.Bucket) error { return putKeys(b, "k", copyBatchSize, []byte("v")) },
+			wantBatches: []int{copyBatchSize},
+		},
+		{
+			name:        "one entry past a batch",
+			fill:        func(b *bolt.Bucket) error { return putKeys(b, "k", copyBatchSize+1, []byte("v")) },
+			wantBatches: []int{copyBatchSize, 1},
+		},
+		{
+			name: "bucket ending a batch",
+			fill: func(b *bolt.Bucket) error {
+				if err := putKeys(b, "a", copyBatchSize-1, []byte("v")); err != nil {
+					return err
+				}
+				sub, err := b.CreateBucket([]byte("b"))
+				if err != nil {
+					return err
+				}
+				if err = sub.SetSequence(7); err != nil {
+					return err
+				}
+				if err = putKeys(sub, "c", 10, []byte("v")); err != nil {
+					return err
+				}
+				return putKeys(b, "d", 5, []byte("v"))
+			},
+			wantBatches: []int{copyBatchSize, 15},
+		},
+		{
+			name: "boundary in nested buckets",
+			fill: func(b *bolt.Bucket) error {
+				sub, err := b.CreateBucket([]byte("a"))
+				if err != nil {
+					return err
+				}
+				deep, err := sub.CreateBucket([]byte("b"))
+				if err != nil {
+					return err
+				}
+				if err = putKeys(deep, "k", 1500, []byte("v")); err != nil {
+					return err
+				}
+				if err = putKeys(sub, "c", 300, []byte("v")); err != nil {
+					return err
+				}
+				if _, err = sub.CreateBucket([]byte("d")); err != nil {
+					return err
+				}
+				return putKeys(b, "e", 300, []byte("v"))
+			},
+			// a, a/b, 1500 keys, 300 keys, a/d and 300 keys: 2103 entries.
+			wantBatches: []int{copyBatchSize, copyBatchSize, 103},
+		},
+		{
+			name:        "size limit",
+			fill:        func(b *bolt.Bucket) error { return putKeys(b, "k", 10, bytes.Repeat([]byte{'x'}, 1<<20)) },
+			wantBatches: []int{4, 4, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+				b, err := createBuckets(tx, "src")
+				if err != nil {
+					return err
+				}
+				return tt.fill(b)
+			})
+			want := bucketEntries(t, r, "src")
+
+			src, err := r.resolvePath("", []string{"src"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			var batches []int
+			err = eachCopyBatch(r.view, src, func(entries []copyEntry) error {
+				if len(got) > len(want) {
+					return errors.New("the batches read more entries than the bucket holds")
+				}
+				batches = append(batches, len(entries))
+				for _, entry := range entries {
+					names := make([]string, len(entry.path))
+					for i, name := range entry.path {
+						names[i] = string(name)
+					}
+					if entry.value == nil {
+						got = append(got, fmt.Sprintf("%s/ #%d", strings.Join(names, "/"), entry.sequence))
+					} else {
+						got = append(got, fmt.Sprintf("%s=%x", strings.Join(names, "/"), entry.value))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("eachCopyBatch() error = %v", err)
+			}
+			if !reflect.DeepEqual(batches, tt.wantBatches) {
+				t.Errorf("batches = %v, want %v", batches, tt.wantBatches)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("batches read %d entries, want the %d entries of the bucket in order", len(got), len(want))
+			}
+
+			if _, err = r.Copy(model.ItemToCopy{LevelStack: []string{"src"}, NewLevelStack: []string{"dst"}}); err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+			if copied := bucketEntries(t, r, "dst"); !reflect.DeepEqual(copied, want) {
+				t.Errorf("copied %d entries, want the %d entries of the source", len(copied), len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+const (
+	// defaultCountLimit is the number of entries counted per bucket when
+	// the caller does not set a limit.
+	defaultCountLimit = 10000
+	// maxCachedCounts bounds the count cache between two writes.
+	maxCachedCounts = 10000
+)
+
+type childCount struct {
+	buckets, pairs int
+	capped         bool
+}
+
+// countCache keeps the counts computed since the last write. Every write
+// commits a new transaction ID, which drops the whole cache.
+type countCache struct {
+	mu      sync.Mutex
+	txID    int
+	entries map[string]childCount
+}
+
+func (c *countCache) get(txID int, key string) (childCount, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.txID != txID {
+		return childCount{}, false
+	}
+	count, ok := c.entries[key]
+	return count, ok
+}
+
+func (c *countCache) put(txID int, key string, count childCount) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.txID != txID || len(c.entries) >= maxCachedCounts {
+		c.txID = txID
+		c.entries = map[string]childCount{}
+	}
+	c.entries[key] = count
+}
+
+// CountChildren counts the child buckets and pairs of the buckets named in
+// input.Keys. Keys that are not buckets are left out. Listings do not
+// count children, since that reads every bucket they show.
+func (r *Repository) CountChildren(input model.CountReqBody) (counts model.BucketCounts, err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return model.BucketCounts{}, err
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultCountLimit
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return model.BucketCounts{}, err
+	}
+	format := r.formatFor(path)
+
+	counts.Counts = make([]model.BucketCount, 0, len(input.Keys))
+	err = r.view(func(tx *bolt.Tx) error {
+		parent := tx.Bucket
+		if len(path.raw) > 0 {
+			rootBkt, err := findBucket(tx, path)
+			if err != nil {
+				return err
+			}
+			parent = rootBkt.Bucket
+		}
+		for _, name := range input.Keys {
+			key, err := format.parseKey(input.Encoding, name)
+			if err != nil {
+				return err
+			}
+			bkt := parent(key)
+			if bkt == nil {
+				continue
+			}
+			cacheKey := fmt.Sprintf("%d %q %q", limit, path.raw, key)
+			count, ok := r.counts.get(tx.ID(), cacheKey)
+			if !ok {
+				count = countChildren(bkt, limit)
+				r.counts.put(tx.ID(), cacheKey, count)
+			}
+			counts.Counts = append(counts.Counts, model.BucketCount{
+				Name:          name,
+				NoOfChildBkts: count.buckets,
+				NoOfPairs:     count.pairs,
+				Capped:        count.capped,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return model.BucketCounts{}, err
+	}
+	counts.LevelStack = input.LevelStack
+	counts.Encoding = input.Encoding
+	return counts, nil
+}
+
+// countChildren counts the entries of b, stopping after limit of them.
+func countChildren(b *bolt.Bucket, limit int) (count childCount) {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if count.buckets+count.pairs == limit {
+			count.capped = true
+			break
+		}
+		if v == nil {
+			count.buckets++
+		} else {
+			count.pairs++
+		}
+	}
+	return count
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestCountChildren(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "root", "small")
+		if err != nil {
+			return err
+		}
+		if _, err = b.CreateBucket([]byte("child")); err != nil {
+			return err
+		}
+		if err = putKeys(b, "key", 2, []byte("v")); err != nil {
+			return err
+		}
+		if b, err = createBuckets(tx, "root", "large"); err != nil {
+			return err
+		}
+		if err = putKeys(b, "key", 50, []byte("v")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("root")).Put([]byte("pair"), []byte("v"))
+	})
+
+	tests := []struct {
+		name    string
+		input   model.CountReqBody
+		want    []model.BucketCount
+		wantErr error
+	}{
+		{
+			name:  "counts",
+			input: model.CountReqBody{LevelStack: []string{"root"}, Keys: []string{"small", "large"}},
+			want: []model.BucketCount{
+				{Name: "small", NoOfChildBkts: 1, NoOfPairs: 2},
+				{Name: "large", NoOfPairs: 50},
+			},
+		},
+		{
+			name:  "limit",
+			input: model.CountReqBody{LevelStack: []string{"root"}, Keys: []string{"small", "large"}, Limit: 3},
+			want: []model.BucketCount{
+				{Name: "small", NoOfChildBkts: 1, NoOfPairs: 2},
+				{Name: "large", NoOfPairs: 3, Capped: true},
+			},
+		},
+		{
+			name:  "pairs and missing keys left out",
+			input: model.CountReqBody{LevelStack: []string{"root"}, Keys: []string{"pair", "missing", "small"}},
+			want:  []model.BucketCount{{Name: "small", NoOfChildBkts: 1, NoOfPairs: 2}},
+		},
+		{
+			name:  "root",
+			input: model.CountReqBody{Keys: []string{"root"}},
+			want:  []model.BucketCount{{Name: "root", NoOfChildBkts: 2, NoOfPairs: 1}},
+		},
+		{
+			name:    "missing path",
+			input:   model.CountReqBody{LevelStack: []string{"missing"}, Keys: []string{"small"}},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.CountChildren(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Counts, tt.want) {
+				t.Errorf("counts = %+v, want %+v", got.Counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountChildren_cache(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "root", "child")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("a"), []byte("v"))
+	})
+
+	input := model.CountReqBody{LevelStack: []string{"root"}, Keys: []string{"child"}}
+	count := func() model.BucketCount {
+		t.Helper()
+		got, err := r.CountChildren(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Counts) != 1 {
+			t.Fatalf("counts = %+v, want one", got.Counts)
+		}
+		return got.Counts[0]
+	}
+
+	if got := count(); got.NoOfPairs != 1 {
+		t.Fatalf("pairs = %d, want 1", got.NoOfPairs)
+	}
+	err := r.AddPairs(model.PairsToAdd{LevelStack: []string{"root", "child"}, Pairs: []model.Pair{{Key: "b", Value: "v"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := count(); got.NoOfPairs != 2 {
+		t.Errorf("pairs after a write = %d, want 2", got.NoOfPairs)
+	}
+}
+
+func TestListElement_noCounts(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "root", "child")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("a"), []byte("v"))
+	})
+
+	elem, err := r.ListElement(model.ListElemReqBody{LevelStack: []string{"root"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.Result{{Name: "child", IsBucket: true}}
+	if !reflect.DeepEqual(elem.Results, want) {
+		t.Errorf("results = %+v, want %+v", elem.Results, want)
+	}
+}
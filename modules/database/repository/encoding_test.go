@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// TestBinaryEncodings checks that bucket names, keys and values that are
+// not valid UTF-8 are listed, fetched and written through the hex and
+// base64 encodings.
+func TestBinaryEncodings(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte{0xff, 0x00})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte{0x01, 0x02}, []byte{0xde, 0xad})
+	})
+
+	tests := []struct {
+		enc        model.Encoding
+		bucket     string
+		key        string
+		value      string
+		newKey     string
+		newValue   string
+		wantStored []byte
+	}{
+		{enc: model.EncodingHex, bucket: "ff00", key: "0102", value: "dead", newKey: "0304", newValue: "beef", wantStored: []byte{0xbe, 0xef}},
+		{enc: model.EncodingBase64, bucket: "/wA=", key: "AQI=", value: "3q0=", newKey: "BQY=", newValue: "AAE=", wantStored: []byte{0x00, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.enc), func(t *testing.T) {
+			root, err := r.ListElement(model.ListElemReqBody{Encoding: tt.enc})
+			if err != nil {
+				t.Fatalf("ListElement() error = %v", err)
+			}
+			if len(root.Results) != 1 || root.Results[0].Name != tt.bucket {
+				t.Errorf("root buckets = %+v, want %s", root.Results, tt.bucket)
+			}
+
+			elem, err := r.GetElement(model.ItemToGet{LevelStack: []string{tt.bucket}, Encoding: tt.enc, Key: tt.key})
+			if err != nil {
+				t.Fatalf("GetElement() error = %v", err)
+			}
+			if elem.Value != tt.value {
+				t.Errorf("GetElement() value = %q, want %q", elem.Value, tt.value)
+			}
+
+			err = r.AddPairs(model.PairsToAdd{
+				LevelStack: []string{tt.bucket},
+				Encoding:   tt.enc,
+				Pairs:      []model.Pair{{Key: tt.newKey, Value: tt.newValue}},
+			})
+			if err != nil {
+				t.Fatalf("AddPairs() error = %v", err)
+			}
+			newKey, _ := tt.enc.DecodeString(tt.newKey)
+			err = r.view(func(tx *bolt.Tx) error {
+				if got := tx.Bucket([]byte{0xff, 0x00}).Get(newKey); !bytes.Equal(got, tt.wantStored) {
+					t.Errorf("stored value = %x, want %x", got, tt.wantStored)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
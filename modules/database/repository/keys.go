@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// bucketPath is a level stack resolved to the stored bucket names.
+type bucketPath struct {
+	// stack is the level stack as given in the request.
+	stack []string
+	// raw holds the stored name of each level.
+	raw [][]byte
+	// names holds the readable name of each level, which bucket patterns
+	// are matched against.
+	names []string
+}
+
+// child returns the path of the bucket stored as raw under p, given in the
+// request form and in the readable form.
+func (p bucketPath) child(raw []byte, stack, name string) bucketPath {
+	return bucketPath{
+		stack: append(p.stack[:len(p.stack):len(p.stack)], stack),
+		raw:   append(p.raw[:len(p.raw):len(p.raw)], raw),
+		names: append(p.names[:len(p.names):len(p.names)], name),
+	}
+}
+
+// resolvePath turns a level stack into stored bucket names. With the utf8
+// encoding each level is given in the readable form of its parent's key
+// codec, binary encodings give the stored names.
+func (r *Repository) resolvePath(enc model.Encoding, levelStack []string) (bucketPath, error) {
+	path := bucketPath{stack: levelStack}
+	for _, val := range levelStack {
+		format := r.formatFor(path)
+		name, err := format.parseKey(enc, val)
+		if err != nil {
+			return bucketPath{}, err
+		}
+		path.raw = append(path.raw, name)
+		if enc.IsBinary() {
+			val, _ = format.displayKey(model.EncodingUTF8, name)
+		}
+		path.names = append(path.names, val)
+	}
+	return path, nil
+}
+
+// displayKey renders a stored key and returns the name of the key codec
+// used, if any. Keys the codec cannot decode are shown as stored.
+func (f bucketFormat) displayKey(enc model.Encoding, k []byte) (string, string) {
+	if enc.IsBinary() || f.key == nil {
+		return enc.EncodeToString(k), ""
+	}
+	name, err := f.key.Decode(k)
+	if err != nil {
+		return string(k), ""
+	}
+	return name, f.key.Name()
+}
+
+// parseKey is the inverse of displayKey. A name the key codec cannot
+// encode, such as a text bucket among integer keys, can only be one shown
+// as stored, and is taken as stored. A stored key that the key codec
+// would also encode, the text "123" among integers, is only reached with
+// a binary encoding.
+func (f bucketFormat) parseKey(enc model.Encoding, s string) ([]byte, error) {
+	if enc.IsBinary() || f.key == nil {
+		return enc.DecodeString(s)
+	}
+	k, err := f.key.Encode(s)
+	if err != nil {
+		return []byte(s), nil
+	}
+	return k, nil
+}
+
+// findBucket walks the path down from the root and returns the innermost
+// bucket.
+func findBucket(tx *bolt.Tx, path bucketPath) (*bolt.Bucket, error) {
+	rootBkt := tx.Bucket(path.raw[0])
+	if rootBkt == nil {
+		return nil, xerrors.Errorf("No Root Bucket found by the name : %s: %w", path.stack[0], ErrNotFound)
+	}
+	for i, name := range path.raw[1:] {
+		rootBkt = rootBkt.Bucket(name)
+		if rootBkt == nil {
+			return nil, xerrors.Errorf("No Bucket found by the name : %s under the level : %s: %w", path.stack[i+1], strings.Join(path.stack[:i+1], "/"), ErrNotFound)
+		}
+	}
+	return rootBkt, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"encoding/binary"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestKeyCodecAddressing(t *testing.T) {
+	r := newTestRepository(t, Options{KeyMappings: []string{"nums=uint64be"}}, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("nums"))
+		if err != nil {
+			return err
+		}
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, 123)
+		if err = b.Put(k, []byte("integer")); err != nil {
+			return err
+		}
+		if err = b.Put([]byte("123"), []byte("text")); err != nil {
+			return err
+		}
+		config, err := b.CreateBucket([]byte("config"))
+		if err != nil {
+			return err
+		}
+		return config.Put([]byte("mode"), []byte("fast"))
+	})
+
+	list, err := r.ListElement(model.ListElemReqBody{LevelStack: []string{"nums"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codecs := map[string]bool{}
+	for _, result := range list.Results {
+		codecs[result.KeyCodec] = true
+	}
+	if !codecs["uint64be"] || !codecs[""] {
+		t.Errorf("key codecs = %v, want the decoded key and the stored one told apart", codecs)
+	}
+
+	tests := []struct {
+		name     string
+		encoding model.Encoding
+		key      string
+		want     string
+		wantErr  bool
+	}{
+		{name: "decoded", key: "123", want: "integer"},
+		// Values are hex encoded too.
+		{name: "stored form", encoding: model.EncodingHex, key: "313233", want: "74657874"},
+		{name: "missing text key", key: "12x", wantErr: true},
+		{name: "bucket not a uint64", key: "config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stack := []string{"nums"}
+			if tt.encoding == model.EncodingHex {
+				stack = []string{"6e756d73"}
+			}
+			got, err := r.GetElement(model.ItemToGet{LevelStack: stack, Encoding: tt.encoding, Key: tt.key})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetElement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Value != tt.want {
+				t.Errorf("GetElement() = %q, want %q", got.Value, tt.want)
+			}
+		})
+	}
+
+	// Names the codec cannot encode are taken as stored, in level stacks
+	// too.
+	got, err := r.GetElement(model.ItemToGet{LevelStack: []string{"nums", "config"}, Key: "mode"})
+	if err != nil {
+		t.Fatalf("GetElement() in a bucket the codec cannot encode error = %v", err)
+	}
+	if got.Value != "fast" {
+		t.Errorf("GetElement() = %q, want %q", got.Value, "fast")
+	}
+	err = r.RenameElement(model.ItemToRename{LevelStack: []string{"nums"}, Key: "config", NewKey: "settings"})
+	if err != nil {
+		t.Fatalf("RenameElement() error = %v", err)
+	}
+	if err = r.DeleteElement(model.ItemToDelete{LevelStack: []string{"nums"}, Key: "settings"}); err != nil {
+		t.Fatalf("DeleteElement() error = %v", err)
+	}
+	err = r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("nums"))
+		if b.Bucket([]byte("config")) != nil || b.Bucket([]byte("settings")) != nil {
+			t.Error("the renamed bucket was not deleted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
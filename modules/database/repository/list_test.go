@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// listPages lists every page of input and returns the names of each page.
+func listPages(t *testing.T, r *Repository, input model.ListElemReqBody) [][]string {
+	t.Helper()
+	var pages [][]string
+	for {
+		elem, err := r.ListElement(input)
+		if err != nil {
+			t.Fatalf("ListElement() error = %v", err)
+		}
+		names := []string{}
+		for _, result := range elem.Results {
+			names = append(names, result.Name)
+		}
+		pages = append(pages, names)
+		if elem.NextKey == "" {
+			return pages
+		}
+		if len(pages) > 100 {
+			t.Fatal("the listing does not end")
+		}
+		input.NextKey = elem.NextKey
+	}
+}
+
+func names(format string, from, to, step int) []string {
+	var s []string
+	for i := from; i < to; i += step {
+		s = append(s, fmt.Sprintf(format, i))
+	}
+	return s
+}
+
+func TestListElement_pages(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "items")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 20; i++ {
+			parity := "odd"
+			if i%2 == 0 {
+				parity = "even"
+			}
+			value := fmt.Sprintf(`{"n":%d,"parity":%q}`, i, parity)
+			if err = b.Put([]byte(fmt.Sprintf("a%02d", i)), []byte(value)); err != nil {
+				return err
+			}
+			if err = b.Put([]byte(fmt.Sprintf("b%02d", i)), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name  string
+		input model.ListElemReqBody
+		want  [][]string
+	}{
+		{
+			name:  "page boundary",
+			input: model.ListElemReqBody{PageSize: 15},
+			want:  [][]string{names("a%02d", 0, 15, 1), append(names("a%02d", 15, 20, 1), names("b%02d", 0, 10, 1)...), names("b%02d", 10, 20, 1)},
+		},
+		{
+			name:  "last page full",
+			input: model.ListElemReqBody{PageSize: 20},
+			want:  [][]string{names("a%02d", 0, 20, 1), names("b%02d", 0, 20, 1)},
+		},
+		{
+			name:  "filter",
+			input: model.ListElemReqBody{PageSize: 8, SearchKey: "b1"},
+			want:  [][]string{names("b%02d", 10, 18, 1), names("b%02d", 18, 20, 1)},
+		},
+		{
+			name:  "prefix",
+			input: model.ListElemReqBody{PageSize: 10, SearchKey: "b", MatchMode: model.MatchPrefix},
+			want:  [][]string{names("b%02d", 0, 10, 1), names("b%02d", 10, 20, 1)},
+		},
+		{
+			name: "value search",
+			input: model.ListElemReqBody{PageSize: 7, SearchKey: "a", MatchMode: model.MatchPrefix,
+				ValueSearch: &model.ValueSearch{Mode: model.ValueMatchField, Path: "parity", Term: `"even"`}},
+			want: [][]string{names("a%02d", 0, 14, 2), names("a%02d", 14, 20, 2)},
+		},
+		{
+			name:  "no match",
+			input: model.ListElemReqBody{PageSize: 10, SearchKey: "zzz"},
+			want:  [][]string{{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.LevelStack = []string{"items"}
+			if got := listPages(t, r, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListElement_invalidNextKey(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		_, err := createBuckets(tx, "items")
+		return err
+	})
+	if _, err := r.ListElement(model.ListElemReqBody{LevelStack: []string{"items"}, NextKey: "!"}); err == nil {
+		t.Error("ListElement() error = nil, want an error")
+	}
+}
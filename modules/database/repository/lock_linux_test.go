@@ -0,0 +1,34 @@
+//go:build linux
+
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestLockHolder(t *testing.T) {
+	if _, err := os.Stat("/proc/locks"); err != nil {
+		t.Skip("/proc/locks is not available")
+	}
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, ok := lockHolder(path)
+	if !ok || pid != os.Getpid() {
+		t.Errorf("lockHolder() = %d, %v, want %d, true", pid, ok, os.Getpid())
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pid, ok = lockHolder(path); ok {
+		t.Errorf("lockHolder() after close = %d, want no holder", pid)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package repository
+
+// lockHolder is only implemented on Linux, where /proc/locks lists the
+// locks held on each file.
+func lockHolder(string) (int, bool) {
+	return 0, false
+}
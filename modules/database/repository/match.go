@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// keyMatcher filters the keys of a listing. Modes that follow the key
+// order set seek and done, so that the cursor skips straight to the first
+// candidate and stops after the last one instead of scanning the bucket.
+type keyMatcher struct {
+	// seek is the first key that can match, nil to start from the first
+	// key of the bucket.
+	seek []byte
+	// done reports whether k and every key after it cannot match.
+	done func(k []byte) bool
+	// match reports whether the displayed name of a key matches.
+	match func(name string) bool
+}
+
+func newKeyMatcher(f bucketFormat, input model.ListElemReqBody) (keyMatcher, error) {
+	m := keyMatcher{
+		done:  func([]byte) bool { return false },
+		match: func(string) bool { return true },
+	}
+	if input.MatchMode == model.MatchExact && input.SearchKey == "" {
+		// Bolt keys are never empty.
+		m.done = func([]byte) bool { return true }
+		return m, nil
+	}
+	if input.SearchKey == "" && input.SearchTo == "" {
+		return m, nil
+	}
+
+	switch input.MatchMode {
+	case "", model.MatchSubstring:
+		searchKey := strings.ToLower(input.SearchKey)
+		m.match = func(name string) bool {
+			return strings.Contains(strings.ToLower(name), searchKey)
+		}
+	case model.MatchPrefix:
+		// The stored bytes of a decoded prefix are not a prefix of the
+		// stored keys, so buckets with a key codec match the names.
+		if f.key != nil && !input.Encoding.IsBinary() {
+			m.match = func(name string) bool {
+				return strings.HasPrefix(name, input.SearchKey)
+			}
+			break
+		}
+		prefix, err := input.Encoding.DecodeString(input.SearchKey)
+		if err != nil {
+			return keyMatcher{}, err
+		}
+		m.seek = prefix
+		m.done = func(k []byte) bool { return !bytes.HasPrefix(k, prefix) }
+	case model.MatchRange:
+		if input.SearchKey != "" {
+			from, err := f.parseKey(input.Encoding, input.SearchKey)
+			if err != nil {
+				return keyMatcher{}, err
+			}
+			m.seek = from
+		}
+		if input.SearchTo != "" {
+			to, err := f.parseKey(input.Encoding, input.SearchTo)
+			if err != nil {
+				return keyMatcher{}, err
+			}
+			m.done = func(k []byte) bool { return bytes.Compare(k, to) >= 0 }
+		}
+	case model.MatchExact:
+		key, err := f.parseKey(input.Encoding, input.SearchKey)
+		if err != nil {
+			return keyMatcher{}, err
+		}
+		m.seek = key
+		m.done = func(k []byte) bool { return !bytes.Equal(k, key) }
+	case model.MatchGlob:
+		re, err := globRegexp(input.SearchKey)
+		if err != nil {
+			return keyMatcher{}, xerrors.Errorf("invalid glob pattern %q: %w", input.SearchKey, err)
+		}
+		m.match = func(name string) bool { return re.MatchString(name) }
+	case model.MatchRegex:
+		re, err := regexp.Compile(input.SearchKey)
+		if err != nil {
+			return keyMatcher{}, xerrors.Errorf("invalid regular expression %q: %w", input.SearchKey, err)
+		}
+		m.match = func(name string) bool { return re.MatchString(name) }
+	}
+	return m, nil
+}
+
+var errBadGlob = errors.New("syntax error in pattern")
+
+// globRegexp compiles a shell pattern with the syntax of path.Match. Keys
+// are not paths, so unlike path.Match, '*' and '?' also match '/'.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '\\':
+			if i++; i == len(runes) {
+				return nil, errBadGlob
+			}
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			i++
+			b.WriteByte('[')
+			if i < len(runes) && runes[i] == '^' {
+				b.WriteByte('^')
+				i++
+			}
+			start := i
+			for ; i < len(runes) && runes[i] != ']'; i++ {
+				switch r := runes[i]; {
+				case r == '-' && i > start:
+					b.WriteRune(r)
+				case r == '\\':
+					if i++; i == len(runes) {
+						return nil, errBadGlob
+					}
+					writeClassRune(&b, runes[i])
+				default:
+					writeClassRune(&b, r)
+				}
+			}
+			if i == len(runes) || i == start {
+				return nil, errBadGlob
+			}
+			b.WriteByte(']')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	b.WriteByte('$')
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, errBadGlob
+	}
+	return re, nil
+}
+
+// writeClassRune writes r as a literal inside a character class.
+func writeClassRune(b *strings.Builder, r rune) {
+	if strings.ContainsRune(`\[]^-`, r) {
+		b.WriteByte('\\')
+	}
+	b.WriteRune(r)
+}
+
+// start returns the key the listing starts from, which is the later of the
+// page token and the first key that can match.
+func (m keyMatcher) start(pageKey []byte) []byte {
+	if bytes.Compare(pageKey, m.seek) > 0 {
+		return pageKey
+	}
+	return m.seek
+}
+
+// matches reports whether a key matches without relying on the cursor
+// having been positioned by seek and stopped by done.
+func (m keyMatcher) matches(k []byte, name string) bool {
+	return bytes.Compare(k, m.seek) >= 0 && !m.done(k) && m.match(name)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "user-*", name: "user-1", want: true},
+		{pattern: "user-*", name: "user-1/profile", want: true},
+		{pattern: "*/profile", name: "users/1/profile", want: true},
+		{pattern: "users/?/profile", name: "users/1/profile", want: true},
+		{pattern: "a?c", name: "a/c", want: true},
+		{pattern: "a?c", name: "abbc", want: false},
+		{pattern: "?", name: "é", want: true},
+		{pattern: "user-*", name: "admin-1", want: false},
+		{pattern: "[a-c]*", name: "beta", want: true},
+		{pattern: "[^a-c]*", name: "beta", want: false},
+		{pattern: "[\\]x]", name: "]", want: true},
+		{pattern: "[[^]", name: "^", want: true},
+		{pattern: "\\*", name: "*", want: true},
+		{pattern: "\\*", name: "a", want: false},
+		{pattern: "a.b", name: "axb", want: false},
+		{pattern: "(a|b)", name: "(a|b)", want: true},
+		{pattern: "*", name: "line\nbreak", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			re, err := globRegexp(tt.pattern)
+			if err != nil {
+				t.Fatalf("globRegexp() error = %v", err)
+			}
+			if got := re.MatchString(tt.name); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+			// Without '/', the patterns match as in path.Match.
+			if want, err := path.Match(tt.pattern, tt.name); err == nil && !strings.Contains(tt.name, "/") && want != tt.want {
+				t.Errorf("path.Match = %v, the test expects %v", want, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobRegexp_invalid(t *testing.T) {
+	for _, pattern := range []string{"[", "[a", "[]", "[^]", "a\\", "[a\\", "[z-a]"} {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := globRegexp(pattern); err == nil {
+				t.Error("globRegexp() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestListElement_matchModes(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "items")
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"apple", "apricot", "banana", "users/1/name"} {
+			if err = b.Put([]byte(k), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name  string
+		input model.ListElemReqBody
+		want  []string
+	}{
+		{name: "no filter", want: []string{"apple", "apricot", "banana", "users/1/name"}},
+		{name: "substring", input: model.ListElemReqBody{SearchKey: "AN"}, want: []string{"banana"}},
+		{name: "prefix", input: model.ListElemReqBody{SearchKey: "ap", MatchMode: model.MatchPrefix}, want: []string{"apple", "apricot"}},
+		{name: "range", input: model.ListElemReqBody{SearchKey: "apricot", SearchTo: "c", MatchMode: model.MatchRange}, want: []string{"apricot", "banana"}},
+		{name: "range without start", input: model.ListElemReqBody{SearchTo: "apricot", MatchMode: model.MatchRange}, want: []string{"apple"}},
+		{name: "exact", input: model.ListElemReqBody{SearchKey: "banana", MatchMode: model.MatchExact}, want: []string{"banana"}},
+		{name: "empty exact", input: model.ListElemReqBody{MatchMode: model.MatchExact}, want: []string{}},
+		{name: "glob", input: model.ListElemReqBody{SearchKey: "users/*", MatchMode: model.MatchGlob}, want: []string{"users/1/name"}},
+		{name: "regex", input: model.ListElemReqBody{SearchKey: "^a.*t$", MatchMode: model.MatchRegex}, want: []string{"apricot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.LevelStack = []string{"items"}
+			got := listPages(t, r, tt.input)
+			if !reflect.DeepEqual(got, [][]string{tt.want}) {
+				t.Errorf("ListElement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
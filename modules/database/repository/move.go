@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"bytes"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucketParent is what holds buckets: the transaction for root buckets, or
+// a bucket for nested ones.
+type bucketParent interface {
+	Bucket(name []byte) *bolt.Bucket
+	CreateBucket(name []byte) (*bolt.Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// findParent returns the bucket at path, or the transaction when path is
+// the root.
+func findParent(tx *bolt.Tx, path bucketPath) (bucketParent, error) {
+	if len(path.raw) == 0 {
+		return tx, nil
+	}
+	return findBucket(tx, path)
+}
+
+// copyBucket copies every pair and nested bucket of src into dst, along
+// with the sequences.
+func copyBucket(dst, src *bolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		child, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(child, src.Bucket(k))
+	})
+}
+
+// samePath reports whether a and b address the same bucket.
+func samePath(a, b bucketPath) bool {
+	if len(a.raw) != len(b.raw) {
+		return false
+	}
+	for i := range a.raw {
+		if !bytes.Equal(a.raw[i], b.raw[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWithin reports whether path is the bucket named key under parent, or
+// is nested in it.
+func isWithin(path, parent bucketPath, key []byte) bool {
+	if len(path.raw) <= len(parent.raw) {
+		return false
+	}
+	prefix := bucketPath{raw: path.raw[:len(parent.raw)]}
+	return samePath(prefix, parent) && bytes.Equal(path.raw[len(parent.raw)], key)
+}
+
+// moveBucket renames the bucket key of src to newKey under dst, which must
+// be free. Buckets cannot be renamed in place, so the subtree is copied and
+// the original deleted, within the caller's transaction.
+func moveBucket(src bucketParent, key []byte, dst bucketParent, newKey []byte) error {
+	copied, err := dst.CreateBucket(newKey)
+	if err != nil {
+		return err
+	}
+	if err = copyBucket(copied, src.Bucket(key)); err != nil {
+		return err
+	}
+	return src.DeleteBucket(key)
+}
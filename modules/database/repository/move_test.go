@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestRenameElement(t *testing.T) {
+	fill := func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "a", "b")
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte("k"), []byte("1")); err != nil {
+			return err
+		}
+		b, err = createBuckets(tx, "c")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("2"))
+	}
+	before := []string{"a/", "a/b/", "a/b/k=1", "c/", "c/k=2"}
+
+	tests := []struct {
+		name    string
+		input   model.ItemToRename
+		want    []string
+		wantErr bool
+		errIs   error
+	}{
+		{
+			name:  "rename pair",
+			input: model.ItemToRename{LevelStack: []string{"c"}, Key: "k", NewKey: "l"},
+			want:  []string{"a/", "a/b/", "a/b/k=1", "c/", "c/l=2"},
+		},
+		{
+			name:  "move bucket",
+			input: model.ItemToRename{LevelStack: []string{"a"}, Key: "b", NewLevelStack: []string{"c"}},
+			want:  []string{"a/", "c/", "c/b/", "c/b/k=1", "c/k=2"},
+		},
+		{
+			name:  "move bucket to the root",
+			input: model.ItemToRename{LevelStack: []string{"a"}, Key: "b", NewLevelStack: []string{}},
+			want:  []string{"a/", "b/", "b/k=1", "c/", "c/k=2"},
+		},
+		{
+			name:    "move pair to the root",
+			input:   model.ItemToRename{LevelStack: []string{"c"}, Key: "k", NewLevelStack: []string{}},
+			wantErr: true,
+		},
+		{
+			name:    "move bucket into itself",
+			input:   model.ItemToRename{Key: "a", NewLevelStack: []string{"a"}},
+			wantErr: true,
+		},
+		{
+			name:    "move bucket into its child",
+			input:   model.ItemToRename{Key: "a", NewLevelStack: []string{"a", "b"}},
+			wantErr: true,
+		},
+		{
+			name:    "onto an existing key",
+			input:   model.ItemToRename{LevelStack: []string{"a", "b"}, Key: "k", NewLevelStack: []string{"c"}},
+			wantErr: true,
+		},
+		{
+			name:    "onto an existing bucket",
+			input:   model.ItemToRename{Key: "a", NewKey: "c"},
+			wantErr: true,
+		},
+		{
+			name:  "same name",
+			input: model.ItemToRename{LevelStack: []string{"c"}, Key: "k", NewKey: "k", IfMatch: versionOf([]byte("2"))},
+			want:  before,
+		},
+		{
+			name:    "same name of a missing key",
+			input:   model.ItemToRename{LevelStack: []string{"c"}, Key: "missing", NewKey: "missing"},
+			wantErr: true,
+		},
+		{
+			name:    "same name with a stale version",
+			input:   model.ItemToRename{LevelStack: []string{"c"}, Key: "k", NewKey: "k", IfMatch: versionOf([]byte("1"))},
+			wantErr: true,
+			errIs:   ErrConflict,
+		},
+		{
+			name:    "stale version",
+			input:   model.ItemToRename{LevelStack: []string{"c"}, Key: "k", NewKey: "l", IfMatch: versionOf([]byte("1"))},
+			wantErr: true,
+			errIs:   ErrConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepository(t, Options{}, fill)
+			err := r.RenameElement(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("RenameElement() error = nil, want an error")
+				}
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Fatalf("RenameElement() error = %v, want %v", err, tt.errIs)
+				}
+				tt.want = before
+			} else if err != nil {
+				t.Fatalf("RenameElement() error = %v", err)
+			}
+
+			var got []string
+			err = r.view(func(tx *bolt.Tx) error {
+				got = plainEntries(tx.Cursor(), tx.Bucket, "")
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// plainEntries lists the entries under c depth-first, with their values
+// as text.
+func plainEntries(c *bolt.Cursor, bucket func([]byte) *bolt.Bucket, prefix string) []string {
+	var entries []string
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			entries = append(entries, prefix+string(k)+"="+string(v))
+			continue
+		}
+		b := bucket(k)
+		entries = append(entries, prefix+string(k)+"/")
+		entries = append(entries, plainEntries(b.Cursor(), b.Bucket, prefix+string(k)+"/")...)
+	}
+	return entries
+}
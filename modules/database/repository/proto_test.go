@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/codec"
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+const testProto = `syntax = "proto3";
+package test;
+
+message User {
+  string name = 1;
+  int32 age = 2;
+  repeated string emails = 3;
+}
+`
+
+func writeTestProto(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "user.proto")
+	if err := os.WriteFile(path, []byte(testProto), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestProtoType checks that values written with a protobuf type configured
+// are stored as that message, and read back as JSON.
+func TestProtoType(t *testing.T) {
+	protoFile := writeTestProto(t)
+	r := newTestRepository(t, Options{
+		ProtoFiles:       []string{filepath.Base(protoFile)},
+		ProtoImportPaths: []string{filepath.Dir(protoFile)},
+		ProtoType:        "test.User",
+	}, func(tx *bolt.Tx) error {
+		_, err := createBuckets(tx, "users")
+		return err
+	})
+
+	types, err := codec.LoadProtoTypes([]string{filepath.Base(protoFile)}, []string{filepath.Dir(protoFile)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := types.Codec("test.User")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := map[string]interface{}{"name": "alice", "age": 30, "emails": []interface{}{"a@example.com"}}
+	err = r.AddPairs(model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: "alice", Value: value}}})
+	if err != nil {
+		t.Fatalf("AddPairs() error = %v", err)
+	}
+	err = r.view(func(tx *bolt.Tx) error {
+		got, err := user.Decode(tx.Bucket([]byte("users")).Get([]byte("alice")))
+		if err != nil {
+			t.Errorf("stored value is not a test.User: %v", err)
+		}
+		if want := `{"name":"alice","age":30,"emails":["a@example.com"]}`; got != want {
+			t.Errorf("stored value = %s, want %s", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.UpdatePairValue(model.ItemToUpdate{LevelStack: []string{"users"}, Key: "alice", NewValue: map[string]interface{}{"name": "alice", "age": 31}})
+	if err != nil {
+		t.Fatalf("UpdatePairValue() error = %v", err)
+	}
+	elem, err := r.GetElement(model.ItemToGet{LevelStack: []string{"users"}, Key: "alice"})
+	if err != nil {
+		t.Fatalf("GetElement() error = %v", err)
+	}
+	if want := `{"name":"alice","age":31}`; elem.Value != want {
+		t.Errorf("GetElement() value = %s, want %s", elem.Value, want)
+	}
+
+	err = r.AddPairs(model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: "bob", Value: map[string]interface{}{"nickname": "b"}}}})
+	if err == nil {
+		t.Error("AddPairs() of a value that is not a test.User succeeded")
+	}
+}
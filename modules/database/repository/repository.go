@@ -1,339 +1,697 @@
 package repository
 
 import (
-	"encoding/json"
-	"fmt"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/jhump/protoreflect/desc"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/pkg/errors"
 
-	"github.com/jhump/protoreflect/desc/protoparse"
 	bolt "go.etcd.io/bbolt"
 	"golang.org/x/xerrors"
 
+	"github.com/knqyf263/boltwiz/modules/database/codec"
 	"github.com/knqyf263/boltwiz/modules/database/model"
 )
 
+// ErrNotFound is returned when a bucket or key addressed by a request does
+// not exist.
+var ErrNotFound = xerrors.New("not found")
+
+// ErrConflict is returned when the version given in if_match is not the
+// version of the stored value anymore.
+var ErrConflict = xerrors.New("version mismatch")
+
+// ErrInvalid is returned when a request is malformed, such as a batch
+// operation of an unknown kind or without a key.
+var ErrInvalid = xerrors.New("invalid request")
+
+// maxPageSize is the number of results returned by ListElement when the
+// caller does not ask for a smaller page.
+const maxPageSize = 1000
+
 type Repository struct {
-	db        *bolt.DB
-	unmarshal func([]byte) string
+	// mu guards db, which is swapped when a snapshot is refreshed.
+	// Transactions are begun under mu with view and update, the previous
+	// snapshot is only closed once those open on it are done.
+	mu       sync.RWMutex
+	db       *bolt.DB
+	dbPath   string
+	snapshot snapshot
+	// lockTimeout is also used for the other files opened, such as the
+	// destination of a copy.
+	lockTimeout time.Duration
+	codecs      *codec.Registry
+	counts      countCache
+	watch       watchHub
 }
 
-func NewRepository(dbPath, protoType string, protoFiles []string) (*Repository, error) {
-	db, err := bolt.Open(dbPath, 0600, nil)
+type Options struct {
+	ProtoType  string
+	ProtoFiles []string
+	// ProtoMappings binds bucket path patterns to message types, in the
+	// form "<pattern>=<message type>" (e.g. "tenants/*/users=acme.User").
+	ProtoMappings []string
+	// ProtoImportPaths are the directories the proto files and their
+	// imports are resolved against.
+	ProtoImportPaths []string
+	// Protosets are binary FileDescriptorSet files, as produced by
+	// `buf build` or `protoc -o`.
+	Protosets []string
+	// ProtoWire decodes the values of buckets without a proto type as
+	// protobuf wire format, without a schema.
+	ProtoWire bool
+	// Codecs are registered in addition to the built-in ones.
+	Codecs []codec.Codec
+	// CodecMappings binds bucket path patterns to codec names, in the form
+	// "<pattern>=<codec>". They take precedence over ProtoMappings.
+	CodecMappings []string
+	// CompressionMappings binds bucket path patterns to compressions, in
+	// the form "<pattern>=<compression>". Other buckets detect compressed
+	// values from their magic bytes.
+	CompressionMappings []string
+	// EncryptionKeyFile holds the AES key of the values in the buckets
+	// matching EncryptionPatterns, as raw bytes or as hex or base64 text.
+	EncryptionKeyFile string
+	// EncryptionNonce is the nonce layout of encrypted values, "prefix"
+	// (the default) or "suffix".
+	EncryptionNonce    string
+	EncryptionPatterns []string
+	// KeyMappings binds bucket path patterns to key codecs, in the form
+	// "<pattern>=<key codec>" (e.g. "events=uint64be").
+	KeyMappings []string
+	// ReadOnly opens the database with a shared lock, so that it can be
+	// browsed alongside other readers, and rejects every write.
+	ReadOnly bool
+	// LockTimeout is how long to wait for the file lock held by another
+	// process. Zero waits forever.
+	LockTimeout time.Duration
+	// Snapshot browses a checked copy of the database file instead of the
+	// file itself, so that a database locked by a running process can be
+	// inspected. Snapshots are read-only.
+	Snapshot bool
+}
+
+func NewRepository(dbPath string, opts Options) (*Repository, error) {
+	codecs, err := newRegistry(opts)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to open db: %w", err)
+		return nil, err
 	}
 
-	unmarshal := func(b []byte) string { return string(b) }
-
-	if protoType != "" && len(protoFiles) > 0 {
-		fileDescriptor, err := protoparse.Parser{}.ParseFiles(protoFiles...)
+	if opts.Snapshot {
+		db, snap, err := takeSnapshot(dbPath)
 		if err != nil {
-			return nil, xerrors.Errorf("failed to parse proto files: %w", err)
-		}
-
-		var md *desc.MessageDescriptor
-		for _, fd := range fileDescriptor {
-			if md = fd.FindMessage(protoType); md != nil {
-				break
-			}
-		}
-		if md == nil {
-			return nil, xerrors.Errorf("failed to find the specified type (%s): %w", protoType, err)
+			return nil, err
 		}
+		return &Repository{
+			db:          db,
+			dbPath:      dbPath,
+			snapshot:    snap,
+			lockTimeout: opts.LockTimeout,
+			codecs:      codecs,
+		}, nil
+	}
 
-		unmarshal = func(b []byte) string {
-			m := dynamic.NewMessage(md)
-			if err := m.Unmarshal(b); err != nil {
-				return fmt.Sprintf("failed to unmarshal message: %v", err)
-			}
-			b, err := json.Marshal(m)
-			if err != nil {
-				return fmt.Sprintf("failed to marshal message: %v", err)
-			}
-			return string(b)
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{
+		ReadOnly: opts.ReadOnly,
+		Timeout:  opts.LockTimeout,
+		// Read-only opens do not load the freelist otherwise, and Stats
+		// would not count the free pages.
+		PreLoadFreelist: opts.ReadOnly,
+	})
+	if xerrors.Is(err, bolt.ErrTimeout) {
+		if pid, ok := lockHolder(dbPath); ok {
+			return nil, xerrors.Errorf("failed to open db: %s is locked by process %d: %w", dbPath, pid, err)
 		}
+		return nil, xerrors.Errorf("failed to open db: %s is locked by another process: %w", dbPath, err)
+	} else if err != nil {
+		return nil, xerrors.Errorf("failed to open db: %w", err)
 	}
 
 	return &Repository{
-		db:        db,
-		unmarshal: unmarshal,
+		db:          db,
+		dbPath:      dbPath,
+		lockTimeout: opts.LockTimeout,
+		codecs:      codecs,
 	}, nil
 }
+
+// conn returns the database being browsed, for reading its settings and
+// counters. Transactions go through view and update.
+func (r *Repository) conn() *bolt.DB {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.db
+}
+
+// begin starts a transaction while holding mu, so that it never starts on
+// a snapshot that RefreshSnapshot has replaced and is closing. Starting one
+// there would wait for every transaction still open on it.
+func (r *Repository) begin(writable bool) (*bolt.Tx, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.db.Begin(writable)
+}
+
+// view is bolt.DB.View on the database being browsed.
+func (r *Repository) view(fn func(*bolt.Tx) error) error {
+	tx, err := r.begin(false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// update is bolt.DB.Update on the database being browsed.
+func (r *Repository) update(fn func(*bolt.Tx) error) error {
+	tx, err := r.begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReadOnly reports whether the database was opened read-only.
+func (r *Repository) ReadOnly() bool {
+	return r.conn().IsReadOnly()
+}
+
 func (r *Repository) Close() error {
+	r.mu.RLock()
+	db, snap := r.db, r.snapshot
+	r.mu.RUnlock()
+
 	// Skip closing the database if the connection is not established.
-	if r.db == nil {
+	if db == nil {
 		return nil
 	}
-	if err := r.db.Close(); err != nil {
+	if err := db.Close(); err != nil {
 		return xerrors.Errorf("failed to close DB: %w", err)
 	}
+	if snap.path != "" {
+		if err := os.Remove(snap.path); err != nil {
+			return xerrors.Errorf("failed to remove the snapshot: %w", err)
+		}
+	}
 	return nil
 }
 
+// TxID returns the ID of the last committed read-write transaction.
+func (r *Repository) TxID() (id int, err error) {
+	err = r.view(func(tx *bolt.Tx) error {
+		id = tx.ID()
+		return nil
+	})
+	return id, err
+}
+
 func (r *Repository) ListElement(input model.ListElemReqBody) (elem model.ListedElem, err error) {
-	var resultFullSet []model.Result
-	cntOfRecords := 0
-	searchkey := strings.ToLower(input.SearchKey)
-	err = r.db.View(func(tx *bolt.Tx) error {
-		var rootBkt *bolt.Bucket
+	pageSize := int(input.PageSize)
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	resultFullSet := make([]model.Result, 0, pageSize)
+	elem.NextKey, err = r.listElements(context.Background(), input, pageSize, func(result model.Result) error {
+		resultFullSet = append(resultFullSet, result)
+		return nil
+	})
+	if err != nil {
+		return model.ListedElem{}, err
+	}
+	elem.LevelStack = input.LevelStack
+	elem.Encoding = input.Encoding
+	elem.SearchKey = input.SearchKey
+	elem.MatchMode = input.MatchMode
+	elem.ValueSearch = input.ValueSearch
+	elem.Results = resultFullSet
+	return elem, nil
+}
+
+// StreamElements passes the results of a listing to emit while the read
+// transaction iterates, instead of collecting them. Without a page size
+// the whole bucket is listed. It stops when ctx is cancelled or emit fails,
+// and returns the next page token when the page size was reached.
+func (r *Repository) StreamElements(ctx context.Context, input model.ListElemReqBody, emit func(model.Result) error) (nextKey string, err error) {
+	return r.listElements(ctx, input, int(input.PageSize), emit)
+}
+
+// listElements lists up to pageSize results, or all of them when pageSize
+// is 0, and returns the next page token.
+func (r *Repository) listElements(ctx context.Context, input model.ListElemReqBody, pageSize int, emit func(model.Result) error) (nextKey string, err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return "", err
+	}
+	if err = input.MatchMode.Validate(); err != nil {
+		return "", err
+	}
+	startKey, err := decodePageToken(input.NextKey)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return "", err
+	}
+	format := r.formatFor(path)
+	matcher, err := newKeyMatcher(format, input)
+	if err != nil {
+		return "", err
+	}
+	var valueMatch valueMatcher
+	if input.ValueSearch != nil {
+		if valueMatch, err = newValueMatcher(*input.ValueSearch); err != nil {
+			return "", err
+		}
+	}
+	err = r.view(func(tx *bolt.Tx) error {
+		var c *bolt.Cursor
 		if len(input.LevelStack) > 0 {
-			rootBkt = tx.Bucket([]byte(input.LevelStack[0]))
-			if rootBkt == nil {
-				return xerrors.New(fmt.Sprintf("No Root Bucket found by the name : %s", input.LevelStack[0]))
+			rootBkt, err := findBucket(tx, path)
+			if err != nil {
+				return err
 			}
-			for i, val := range input.LevelStack[1:] {
-				rootBkt = rootBkt.Bucket([]byte(val))
-				if rootBkt == nil {
-					return xerrors.New(fmt.Sprintf("No Bucket found by the name : %s under the level : %s", val, strings.Join(input.LevelStack[:i+1], "/")))
-				}
+			c = rootBkt.Cursor()
+		} else {
+			c = tx.Cursor()
+		}
+
+		// Seek straight to the first key of the requested page so that
+		// later pages cost the same as the first one.
+		count := 0
+		k, v := c.First()
+		if start := matcher.start(startKey); start != nil {
+			k, v = c.Seek(start)
+		}
+		for ; k != nil && !matcher.done(k); k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-			_ = rootBkt.ForEach(func(k []byte, v []byte) error {
-				if input.SearchKey != "" && !strings.Contains(strings.ToLower(string(k)), searchkey) {
-					return nil
-				}
-				cntOfRecords += 1
-				if cntOfRecords > 10000 {
-					elem.ExceedsLimit = true
-					return nil
-				}
+			name, _ := format.displayKey(input.Encoding, k)
+			if !matcher.match(name) {
+				continue
+			}
+			// Value searches run on the decoded value whatever the
+			// requested encoding, and skip buckets.
+			var excerpt *model.Excerpt
+			if valueMatch != nil {
 				if v == nil {
-					elBkt := rootBkt.Bucket(k)
-					bktCnt, pairCnt := getInlineBucketandPairCount(elBkt)
-					resultFullSet = append(resultFullSet,
-						model.Result{
-							Name:          string(k),
-							IsBucket:      true,
-							Value:         "",
-							NoOfChildBkts: bktCnt,
-							NoOfPairs:     pairCnt,
-						})
-				} else {
-					resultFullSet = append(resultFullSet,
-						model.Result{
-							Name:     string(k),
-							IsBucket: false,
-							Value:    r.unmarshal(v),
-						})
+					continue
 				}
-				return nil
-			})
-		} else {
-			_ = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
-				if input.SearchKey != "" && !strings.Contains(strings.ToLower(string(name)), searchkey) {
-					return nil
-				}
-				cntOfRecords += 1
-				if cntOfRecords > 10000 {
-					elem.ExceedsLimit = true
-					return nil
+				if excerpt = valueMatch(r.decodeValue(format, model.EncodingUTF8, v).value); excerpt == nil {
+					continue
 				}
-				bktCnt, pairCnt := getInlineBucketandPairCount(b)
-				resultFullSet = append(resultFullSet,
-					model.Result{
-						Name:          string(name),
-						IsBucket:      true,
-						Value:         "",
-						NoOfChildBkts: bktCnt,
-						NoOfPairs:     pairCnt,
-					})
-
-				return nil
-			})
-		}
+			}
+			if count == pageSize && pageSize > 0 {
+				nextKey = encodePageToken(k)
+				break
+			}
+			count++
 
-		elem.LevelStack = input.LevelStack
-		elem.SearchKey = input.SearchKey
-		elem.Results = resultFullSet
+			result := r.newResult(format, input.Encoding, k, v)
+			result.Excerpt = excerpt
+			if err := emit(result); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 	if err != nil {
-		return model.ListedElem{}, err
+		return "", err
 	}
-	return elem, nil
+	return nextKey, nil
 }
 
-func getInlineBucketandPairCount(b *bolt.Bucket) (bktCnt, pairCnt int) {
-	_ = b.ForEach(func(k, v []byte) error {
-		if v == nil {
-			bktCnt = bktCnt + 1
-		} else {
-			pairCnt = pairCnt + 1
+// newResult describes a key of a listing, a bucket when v is nil.
+func (r *Repository) newResult(format bucketFormat, enc model.Encoding, k, v []byte) model.Result {
+	name, keyCodec := format.displayKey(enc, k)
+	if v == nil {
+		// Children are counted on demand by CountChildren.
+		return model.Result{
+			Name:     name,
+			IsBucket: true,
+			Value:    "",
+			KeyCodec: keyCodec,
 		}
-		return nil
-	})
-	return bktCnt, pairCnt
+	}
+	value := r.decodeValue(format, enc, v)
+	return model.Result{
+		Name:        name,
+		IsBucket:    false,
+		Value:       value.value,
+		Codec:       value.codec,
+		Compression: value.compression,
+		Encrypted:   value.encrypted,
+		KeyCodec:    keyCodec,
+		Version:     versionOf(v),
+	}
 }
-func (r *Repository) AddBuckets(input model.BucketsToAdd) (err error) {
-	err = r.db.Update(func(tx *bolt.Tx) error {
+
+// GetElement returns a single key with its full decoded value. ErrNotFound
+// is returned when the key or one of its parent buckets does not exist.
+func (r *Repository) GetElement(input model.ItemToGet) (elem model.FetchedElem, err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return model.FetchedElem{}, err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return model.FetchedElem{}, err
+	}
+	format := r.formatFor(path)
+	key, err := format.parseKey(input.Encoding, input.Key)
+	if err != nil {
+		return model.FetchedElem{}, err
+	}
+	err = r.view(func(tx *bolt.Tx) error {
 		var rootBkt *bolt.Bucket
 		if len(input.LevelStack) > 0 {
-			rootBkt = tx.Bucket([]byte(input.LevelStack[0]))
-			if rootBkt == nil {
-				return xerrors.New(fmt.Sprintf("No Root Bucket found by the name : %s", input.LevelStack[0]))
-			}
-			for i, val := range input.LevelStack[1:] {
-				rootBkt = rootBkt.Bucket([]byte(val))
-				if rootBkt == nil {
-					return xerrors.New(fmt.Sprintf("No Bucket found by the name : %s under the level : %s", val, strings.Join(input.LevelStack[:i+1], "/")))
-				}
-			}
-			for _, bkt := range input.Buckets {
-				_, err = rootBkt.CreateBucket([]byte(bkt))
-				if err != nil {
-					return errors.Wrapf(err, "Unable to create bucket %s under stack %s", bkt, input.LevelStack)
-				}
+			rootBkt, err = findBucket(tx, path)
+			if err != nil {
+				return err
 			}
 		} else {
-			for _, bkt := range input.Buckets {
-				_, err = tx.CreateBucket([]byte(bkt))
-				if err != nil {
-					return errors.Wrapf(err, "Unable to create bucket %s under root", bkt)
-				}
+			if tx.Bucket(key) == nil {
+				return xerrors.Errorf("No Root Bucket found by the name : %s: %w", input.Key, ErrNotFound)
 			}
+			elem.IsBucket = true
+			return nil
+		}
+
+		if rootBkt.Bucket(key) != nil {
+			elem.IsBucket = true
+			return nil
+		}
+		val := rootBkt.Get(key)
+		if val == nil {
+			return xerrors.Errorf("No Key found by the name : %s under the level : %s: %w", input.Key, strings.Join(input.LevelStack, "/"), ErrNotFound)
 		}
+		value := r.decodeValue(format, input.Encoding, val)
+		elem.Value, elem.Codec, elem.Compression, elem.Encrypted = value.value, value.codec, value.compression, value.encrypted
+		elem.Size = len(val)
+		elem.Version = versionOf(val)
 		return nil
 	})
-	return err
+	if err != nil {
+		return model.FetchedElem{}, err
+	}
+	elem.LevelStack = input.LevelStack
+	elem.Encoding = input.Encoding
+	elem.Key = input.Key
+	return elem, nil
 }
 
-func (r *Repository) AddPairs(input model.PairsToAdd) (err error) {
-	err = r.db.Update(func(tx *bolt.Tx) error {
-		var rootBkt *bolt.Bucket
-		if len(input.LevelStack) == 0 {
-			return errors.New("Cannot create key/value pairs without parent bucket, levelstack missing")
-		}
-		rootBkt = tx.Bucket([]byte(input.LevelStack[0]))
-		if rootBkt == nil {
-			return xerrors.New(fmt.Sprintf("No Root Bucket found by the name : %s", input.LevelStack[0]))
+// encodePageToken turns the first key of the next page into an opaque token.
+func encodePageToken(k []byte) string {
+	return base64.RawURLEncoding.EncodeToString(k)
+}
+
+func decodePageToken(token string) ([]byte, error) {
+	if token == "" {
+		return nil, nil
+	}
+	k, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid next key: %w", err)
+	}
+	return k, nil
+}
+
+func (r *Repository) AddBuckets(input model.BucketsToAdd) error {
+	return r.update(func(tx *bolt.Tx) error {
+		return r.addBuckets(tx, input)
+	})
+}
+
+func (r *Repository) addBuckets(tx *bolt.Tx, input model.BucketsToAdd) (err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return err
+	}
+	format := r.formatFor(path)
+	if len(input.LevelStack) > 0 {
+		rootBkt, err := findBucket(tx, path)
+		if err != nil {
+			return err
 		}
-		for i, val := range input.LevelStack[1:] {
-			rootBkt = rootBkt.Bucket([]byte(val))
-			if rootBkt == nil {
-				return xerrors.New(fmt.Sprintf("No Bucket found by the name : %s under the level : %s", val, strings.Join(input.LevelStack[:i+1], "/")))
+		for _, bkt := range input.Buckets {
+			name, err := format.parseKey(input.Encoding, bkt)
+			if err != nil {
+				return err
+			}
+			_, err = rootBkt.CreateBucket(name)
+			if err != nil {
+				return errors.Wrapf(err, "Unable to create bucket %s under stack %s", bkt, input.LevelStack)
 			}
 		}
-		for _, pair := range input.Pairs {
-			val, err1 := json.Marshal(pair.Value)
-			if err1 != nil {
-				return errors.Wrapf(err1, "Unable to marshal the value %v", pair.Value)
+	} else {
+		for _, bkt := range input.Buckets {
+			name, err := format.parseKey(input.Encoding, bkt)
+			if err != nil {
+				return err
 			}
-			err = rootBkt.Put([]byte(pair.Key), val)
+			_, err = tx.CreateBucket(name)
 			if err != nil {
-				return errors.Wrapf(err, "Unable to create pair %s under stack %s", pair, input.LevelStack)
+				return errors.Wrapf(err, "Unable to create bucket %s under root", bkt)
 			}
 		}
-		return nil
+	}
+	return nil
+}
+
+func (r *Repository) AddPairs(input model.PairsToAdd) error {
+	return r.update(func(tx *bolt.Tx) error {
+		return r.addPairs(tx, input)
 	})
-	return err
 }
 
-func (r *Repository) DeleteElement(input model.ItemToDelete) (err error) {
-	err = r.db.Update(func(tx *bolt.Tx) error {
-		var rootBkt *bolt.Bucket
-		if len(input.LevelStack) > 0 {
-			rootBkt = tx.Bucket([]byte(input.LevelStack[0]))
-			if rootBkt == nil {
-				return xerrors.New(fmt.Sprintf("No Root Bucket found by the name : %s", input.LevelStack[0]))
-			}
-			for i, val := range input.LevelStack[1:] {
-				rootBkt = rootBkt.Bucket([]byte(val))
-				if rootBkt == nil {
-					return xerrors.New(fmt.Sprintf("No Bucket found by the name : %s under the level : %s", val, strings.Join(input.LevelStack[:i+1], "/")))
-				}
-			}
-			if bkt := rootBkt.Bucket([]byte(input.Key)); bkt != nil {
-				err = rootBkt.DeleteBucket([]byte(input.Key))
-				if err != nil {
-					return errors.Wrapf(err, "Unable to delete bucket %s under stack %s", input.Key, input.LevelStack)
-				}
-			} else {
-				err = rootBkt.Delete([]byte(input.Key))
-				if err != nil {
-					return errors.Wrapf(err, "Unable to delete key %s under stack %s", input.Key, input.LevelStack)
-				}
+func (r *Repository) addPairs(tx *bolt.Tx, input model.PairsToAdd) (err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return err
+	}
+	format := r.formatFor(path)
+	if len(input.LevelStack) == 0 {
+		return errors.New("Cannot create key/value pairs without parent bucket, levelstack missing")
+	}
+	rootBkt, err := findBucket(tx, path)
+	if err != nil {
+		return err
+	}
+	for _, pair := range input.Pairs {
+		key, err := format.parseKey(input.Encoding, pair.Key)
+		if err != nil {
+			return err
+		}
+		val, err := r.encodeValue(format, input.Encoding, pair.Value, rootBkt.Get(key))
+		if err != nil {
+			return err
+		}
+		err = rootBkt.Put(key, val)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to create pair %s under stack %s", pair, input.LevelStack)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) DeleteElement(input model.ItemToDelete) error {
+	return r.update(func(tx *bolt.Tx) error {
+		return r.deleteElement(tx, input)
+	})
+}
+
+func (r *Repository) deleteElement(tx *bolt.Tx, input model.ItemToDelete) (err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return err
+	}
+	format := r.formatFor(path)
+	key, err := format.parseKey(input.Encoding, input.Key)
+	if err != nil {
+		return err
+	}
+	if len(input.LevelStack) > 0 {
+		rootBkt, err := findBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		if err = checkVersion(input.IfMatch, input.Key, rootBkt.Get(key)); err != nil {
+			return err
+		}
+		if bkt := rootBkt.Bucket(key); bkt != nil {
+			err = rootBkt.DeleteBucket(key)
+			if err != nil {
+				return errors.Wrapf(err, "Unable to delete bucket %s under stack %s", input.Key, input.LevelStack)
 			}
 		} else {
-			err = tx.DeleteBucket([]byte(input.Key))
+			err = rootBkt.Delete(key)
 			if err != nil {
-				return errors.Wrapf(err, "Unable to delete bucket %s under root", input.Key)
+				return errors.Wrapf(err, "Unable to delete key %s under stack %s", input.Key, input.LevelStack)
 			}
 		}
-		return nil
+	} else {
+		if err = checkVersion(input.IfMatch, input.Key, nil); err != nil {
+			return err
+		}
+		err = tx.DeleteBucket(key)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to delete bucket %s under root", input.Key)
+		}
+	}
+	return nil
+}
+
+// RenameElement renames a pair or a bucket, and moves it to another bucket
+// when NewLevelStack is set. Buckets are moved with all of their content.
+// Pairs keep their stored bytes, so the value format of the destination is
+// not applied.
+func (r *Repository) RenameElement(input model.ItemToRename) error {
+	return r.update(func(tx *bolt.Tx) error {
+		return r.renameElement(tx, input)
 	})
-	return err
 }
 
-func (r *Repository) RenameElement(input model.ItemToRename) (err error) {
-	err = r.db.Update(func(tx *bolt.Tx) error {
-		var rootBkt *bolt.Bucket
-		if len(input.LevelStack) > 0 {
-			rootBkt = tx.Bucket([]byte(input.LevelStack[0]))
-			if rootBkt == nil {
-				return xerrors.New(fmt.Sprintf("No Root Bucket found by the name : %s", input.LevelStack[0]))
-			}
+func (r *Repository) renameElement(tx *bolt.Tx, input model.ItemToRename) (err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return err
+	}
+	format := r.formatFor(path)
+	key, err := format.parseKey(input.Encoding, input.Key)
+	if err != nil {
+		return err
+	}
+	newPath := path
+	if input.NewLevelStack != nil {
+		if newPath, err = r.resolvePath(input.Encoding, input.NewLevelStack); err != nil {
+			return err
+		}
+	}
+	newName, newKey := input.Key, key
+	if input.NewKey != "" {
+		newName = input.NewKey
+		if newKey, err = r.formatFor(newPath).parseKey(input.Encoding, input.NewKey); err != nil {
+			return err
+		}
+	}
 
-			for i, val := range input.LevelStack[1:] {
-				rootBkt = rootBkt.Bucket([]byte(val))
-				if rootBkt == nil {
-					return xerrors.New(fmt.Sprintf("No Bucket found by the name : %s under the level : %s", val, strings.Join(input.LevelStack[:i+1], "/")))
-				}
-			}
+	parent, err := findParent(tx, path)
+	if err != nil {
+		return err
+	}
+	newParent, err := findParent(tx, newPath)
+	if err != nil {
+		return err
+	}
+	var current []byte
+	if rootBkt, ok := parent.(*bolt.Bucket); ok {
+		current = rootBkt.Get(key)
+	}
+	if err = checkVersion(input.IfMatch, input.Key, current); err != nil {
+		return err
+	}
+	isBucket := parent.Bucket(key) != nil
+	if !isBucket && current == nil {
+		return errors.New("No Key found to be replaced")
+	}
+	// Renaming a key to itself changes nothing, once the key is known to
+	// exist and to have the expected version.
+	if samePath(path, newPath) && bytes.Equal(key, newKey) {
+		return nil
+	}
+	newBkt, _ := newParent.(*bolt.Bucket)
+	if newParent.Bucket(newKey) != nil || (newBkt != nil && newBkt.Get(newKey) != nil) {
+		return errors.Errorf("%s already exists under stack %s", newName, newPath.stack)
+	}
 
-			val := rootBkt.Get([]byte(input.Key))
-			if val != nil {
-				err = rootBkt.Put([]byte(input.NewKey), val)
-				if err != nil {
-					return errors.Wrapf(err, "Unable to put key %s under stack %s", input.NewKey, input.LevelStack)
-				}
-				err = rootBkt.Delete([]byte(input.Key))
-				if err != nil {
-					return errors.Wrapf(err, "Unable to delete key %s under stack %s", input.Key, input.LevelStack)
-				}
-			} else {
-				return errors.New("No Key found to be replaced")
-			}
-		} else {
-			return errors.New("Buckets cannot be renamed, please provide level stack")
+	if isBucket {
+		if isWithin(newPath, path, key) {
+			return errors.New("A bucket cannot be moved into itself")
+		}
+		err = moveBucket(parent, key, newParent, newKey)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to move bucket %s to %s under stack %s", input.Key, newName, newPath.stack)
 		}
 		return nil
+	}
+
+	val := current
+	if newBkt == nil {
+		return errors.New("Pairs cannot be moved to the root, please provide new level stack")
+	}
+	err = newBkt.Put(newKey, val)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to put key %s under stack %s", newName, newPath.stack)
+	}
+	err = parent.(*bolt.Bucket).Delete(key)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to delete key %s under stack %s", input.Key, input.LevelStack)
+	}
+	return nil
+}
+
+func (r *Repository) UpdatePairValue(input model.ItemToUpdate) error {
+	return r.update(func(tx *bolt.Tx) error {
+		return r.updatePairValue(tx, input)
 	})
-	return err
 }
 
-func (r *Repository) UpdatePairValue(input model.ItemToUpdate) (err error) {
-	err = r.db.Update(func(tx *bolt.Tx) error {
-		var rootBkt *bolt.Bucket
-		if len(input.LevelStack) > 0 {
-			rootBkt = tx.Bucket([]byte(input.LevelStack[0]))
-			if rootBkt == nil {
-				return xerrors.New(fmt.Sprintf("No Root Bucket found by the name : %s", input.LevelStack[0]))
-			}
-			for i, val := range input.LevelStack[1:] {
-				rootBkt = rootBkt.Bucket([]byte(val))
-				if rootBkt == nil {
-					return xerrors.New(fmt.Sprintf("No Bucket found by the name : %s under the level : %s", val, strings.Join(input.LevelStack[:i+1], "/")))
-				}
+func (r *Repository) updatePairValue(tx *bolt.Tx, input model.ItemToUpdate) (err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return err
+	}
+	format := r.formatFor(path)
+	key, err := format.parseKey(input.Encoding, input.Key)
+	if err != nil {
+		return err
+	}
+	if len(input.LevelStack) > 0 {
+		rootBkt, err := findBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		if err = checkVersion(input.IfMatch, input.Key, rootBkt.Get(key)); err != nil {
+			return err
+		}
+		if val := rootBkt.Get(key); val != nil {
+			val1, err1 := r.encodeValue(format, input.Encoding, input.NewValue, val)
+			if err1 != nil {
+				return err1
 			}
-			if val := rootBkt.Get([]byte(input.Key)); val != nil {
-				val1, err1 := json.Marshal(input.NewValue)
-				if err1 != nil {
-					return errors.Wrapf(err1, "Unable to marshal the value %v", input.NewValue)
-				}
-				err = rootBkt.Put([]byte(input.Key), val1)
-				if err != nil {
-					return errors.Wrap(err, "Unable to put new value")
-				}
-			} else {
-				return errors.New("Given key not found")
+			err = rootBkt.Put(key, val1)
+			if err != nil {
+				return errors.Wrap(err, "Unable to put new value")
 			}
 		} else {
-			return errors.New("Please provide level stack")
+			return errors.New("Given key not found")
 		}
-		return nil
-	})
-	return err
+	} else {
+		return errors.New("Please provide level stack")
+	}
+	return nil
 }
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// newTestRepository opens a repository on a new file filled by fill.
+func newTestRepository(t *testing.T, opts Options, fill func(tx *bolt.Tx) error) *Repository {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill != nil {
+		if err = db.Update(fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRepository(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// createBuckets creates the nested buckets of path.
+func createBuckets(tx *bolt.Tx, path ...string) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte(path[0]))
+	for _, name := range path[1:] {
+		if err != nil {
+			return nil, err
+		}
+		b, err = b.CreateBucketIfNotExists([]byte(name))
+	}
+	return b, err
+}
+
+func TestGetElement(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "users", "settings")
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte("theme"), []byte(`"dark"`)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("users")).Put([]byte("alice"), []byte(`{"age":30}`))
+	})
+
+	tests := []struct {
+		name    string
+		input   model.ItemToGet
+		want    model.FetchedElem
+		wantErr error
+	}{
+		{
+			name:  "value",
+			input: model.ItemToGet{LevelStack: []string{"users"}, Key: "alice"},
+			want:  model.FetchedElem{LevelStack: []string{"users"}, Key: "alice", Value: `{"age":30}`, Codec: "raw", Size: 10, Version: versionOf([]byte(`{"age":30}`))},
+		},
+		{
+			name:  "nested value",
+			input: model.ItemToGet{LevelStack: []string{"users", "settings"}, Key: "theme"},
+			want:  model.FetchedElem{LevelStack: []string{"users", "settings"}, Key: "theme", Value: `"dark"`, Codec: "raw", Size: 6, Version: versionOf([]byte(`"dark"`))},
+		},
+		{
+			name:  "bucket",
+			input: model.ItemToGet{LevelStack: []string{"users"}, Key: "settings"},
+			want:  model.FetchedElem{LevelStack: []string{"users"}, Key: "settings", IsBucket: true},
+		},
+		{
+			name:  "root bucket",
+			input: model.ItemToGet{Key: "users"},
+			want:  model.FetchedElem{Key: "users", IsBucket: true},
+		},
+		{name: "missing key", input: model.ItemToGet{LevelStack: []string{"users"}, Key: "bob"}, wantErr: ErrNotFound},
+		{name: "missing bucket", input: model.ItemToGet{LevelStack: []string{"groups"}, Key: "alice"}, wantErr: ErrNotFound},
+		{name: "missing root bucket", input: model.ItemToGet{Key: "groups"}, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.GetElement(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetElement() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetElement() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetElement() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRepository_lock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte("users"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewRepository(path, Options{LockTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, bolt.ErrTimeout) {
+		t.Fatalf("NewRepository() error = %v, want %v", err, bolt.ErrTimeout)
+	}
+	if !strings.Contains(err.Error(), path+" is locked by") {
+		t.Errorf("NewRepository() error = %v, want it to name the locked file", err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only repositories share the lock with each other.
+	r1, err := NewRepository(path, Options{ReadOnly: true, LockTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	r2, err := NewRepository(path, Options{ReadOnly: true, LockTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("second read-only NewRepository() error = %v", err)
+	}
+	defer r2.Close()
+	if !r2.ReadOnly() {
+		t.Error("ReadOnly() = false, want true")
+	}
+	if _, err = r2.ListElement(model.ListElemReqBody{LevelStack: []string{"users"}}); err != nil {
+		t.Errorf("ListElement() error = %v", err)
+	}
+	err = r2.AddPairs(model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: "bob", Value: 1}}})
+	if !errors.Is(err, bolt.ErrDatabaseReadOnly) {
+		t.Errorf("AddPairs() error = %v, want %v", err, bolt.ErrDatabaseReadOnly)
+	}
+}
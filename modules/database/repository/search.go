@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+const (
+	defaultSearchTimeout = 10 * time.Second
+	maxSearchTimeout     = time.Minute
+)
+
+// errSearchDone stops the walk once the result cap is reached.
+var errSearchDone = xerrors.New("search done")
+
+// Search walks every bucket nested under input.LevelStack and passes each
+// match to emit as soon as it is found. It stops when the result cap or
+// the time budget is reached, when ctx is cancelled, or when emit fails.
+func (r *Repository) Search(ctx context.Context, input model.SearchReqBody, emit func(model.SearchMatch) error) (summary model.SearchSummary, err error) {
+	if err = input.Encoding.Validate(); err != nil {
+		return summary, err
+	}
+	if err = input.MatchMode.Validate(); err != nil {
+		return summary, err
+	}
+	maxResults := input.MaxResults
+	if maxResults <= 0 || maxResults > maxPageSize {
+		maxResults = maxPageSize
+	}
+	timeout := time.Duration(input.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultSearchTimeout
+	} else if timeout > maxSearchTimeout {
+		timeout = maxSearchTimeout
+	}
+	var valueMatch valueMatcher
+	if input.ValueSearch != nil {
+		if valueMatch, err = newValueMatcher(*input.ValueSearch); err != nil {
+			return summary, err
+		}
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return summary, err
+	}
+	if path.stack == nil {
+		path.stack = []string{}
+	}
+	listInput := model.ListElemReqBody{
+		Encoding:  input.Encoding,
+		SearchKey: input.SearchKey,
+		MatchMode: input.MatchMode,
+		SearchTo:  input.SearchTo,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// walk searches the bucket under c, then its nested buckets.
+	var walk func(path bucketPath, c *bolt.Cursor) error
+	walk = func(path bucketPath, c *bolt.Cursor) error {
+		summary.Buckets++
+		format := r.formatFor(path)
+		matcher, err := newKeyMatcher(format, listInput)
+		if err != nil {
+			return err
+		}
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			name, keyCodec := format.displayKey(input.Encoding, k)
+			if matcher.matches(k, name) {
+				match := model.SearchMatch{
+					LevelStack: path.stack,
+					Result:     model.Result{Name: name, IsBucket: v == nil, KeyCodec: keyCodec},
+				}
+				ok := true
+				if v != nil {
+					value := r.decodeValue(format, input.Encoding, v)
+					match.Value, match.Codec, match.Compression, match.Encrypted = value.value, value.codec, value.compression, value.encrypted
+					match.Version = versionOf(v)
+					if valueMatch != nil {
+						if input.Encoding.IsBinary() {
+							value = r.decodeValue(format, model.EncodingUTF8, v)
+						}
+						match.Excerpt = valueMatch(value.value)
+						ok = match.Excerpt != nil
+					}
+				} else {
+					ok = valueMatch == nil
+				}
+				if ok {
+					if summary.Matches == maxResults {
+						summary.Truncated = true
+						return errSearchDone
+					}
+					summary.Matches++
+					if err := emit(match); err != nil {
+						return err
+					}
+				}
+			}
+
+			if v == nil {
+				readable, _ := format.displayKey(model.EncodingUTF8, k)
+				if err := walk(path.child(k, name, readable), c.Bucket().Bucket(k).Cursor()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	err = r.view(func(tx *bolt.Tx) error {
+		if len(path.raw) == 0 {
+			return walk(path, tx.Cursor())
+		}
+		bkt, err := findBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		return walk(path, bkt.Cursor())
+	})
+	switch {
+	case xerrors.Is(err, errSearchDone):
+		err = nil
+	case xerrors.Is(err, context.DeadlineExceeded):
+		summary.TimedOut = true
+		err = nil
+	}
+	return summary, err
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestSearch(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "a", "b", "c")
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte("target"), []byte(`{"id":3}`)); err != nil {
+			return err
+		}
+		b, err = createBuckets(tx, "a")
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte("target"), []byte(`{"id":1}`)); err != nil {
+			return err
+		}
+		b, err = createBuckets(tx, "z", "target")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("other"), []byte(`{"id":2}`))
+	})
+
+	tests := []struct {
+		name        string
+		input       model.SearchReqBody
+		want        []string
+		wantSummary model.SearchSummary
+	}{
+		{
+			name:        "whole file",
+			input:       model.SearchReqBody{SearchKey: "target"},
+			want:        []string{"a/b/c/target", "a/target", "z/target/"},
+			wantSummary: model.SearchSummary{Matches: 3, Buckets: 6},
+		},
+		{
+			name:        "under a path",
+			input:       model.SearchReqBody{LevelStack: []string{"a", "b"}, SearchKey: "target"},
+			want:        []string{"a/b/c/target"},
+			wantSummary: model.SearchSummary{Matches: 1, Buckets: 2},
+		},
+		{
+			name:        "max results",
+			input:       model.SearchReqBody{SearchKey: "target", MaxResults: 1},
+			want:        []string{"a/b/c/target"},
+			wantSummary: model.SearchSummary{Matches: 1, Buckets: 4, Truncated: true},
+		},
+		{
+			name:        "value search",
+			input:       model.SearchReqBody{ValueSearch: &model.ValueSearch{Mode: model.ValueMatchField, Path: "id", Term: "2"}},
+			want:        []string{"z/target/other"},
+			wantSummary: model.SearchSummary{Matches: 1, Buckets: 6},
+		},
+		{
+			name:        "no match",
+			input:       model.SearchReqBody{SearchKey: "missing"},
+			wantSummary: model.SearchSummary{Buckets: 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			summary, err := r.Search(context.Background(), tt.input, func(match model.SearchMatch) error {
+				name := strings.Join(append(append([]string{}, match.LevelStack...), match.Name), "/")
+				if match.IsBucket {
+					name += "/"
+				}
+				got = append(got, name)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+			if summary != tt.wantSummary {
+				t.Errorf("summary = %+v, want %+v", summary, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestSearch_cancelled(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "a")
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := r.Search(ctx, model.SearchReqBody{}, func(model.SearchMatch) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// ErrNoSnapshot is returned when a snapshot is refreshed while the
+// database is browsed directly.
+var ErrNoSnapshot = xerrors.New("not in snapshot mode")
+
+// snapshotAttempts is how many copies are taken before giving up when the
+// owner of the database commits while the file is copied.
+const snapshotAttempts = 3
+
+// snapshot is a checked copy of the database file.
+type snapshot struct {
+	path    string
+	takenAt time.Time
+	// source is the database file as it was before the copy. File times
+	// are coarser than time.Now, so they are compared with each other.
+	source os.FileInfo
+}
+
+// takeSnapshot copies the database file to a temp file without taking its
+// lock, and opens the copy read-only once all its buckets could be read.
+func takeSnapshot(dbPath string) (*bolt.DB, snapshot, error) {
+	var lastErr error
+	for i := 0; i < snapshotAttempts; i++ {
+		takenAt := time.Now()
+		source, err := os.Stat(dbPath)
+		if err != nil {
+			return nil, snapshot{}, xerrors.Errorf("failed to copy db: %w", err)
+		}
+		path, err := copyFile(dbPath)
+		if err != nil {
+			return nil, snapshot{}, xerrors.Errorf("failed to copy db: %w", err)
+		}
+		db, err := openSnapshot(path)
+		if err == nil {
+			return db, snapshot{path: path, takenAt: takenAt, source: source}, nil
+		}
+		_ = os.Remove(path)
+		lastErr = err
+	}
+	return nil, snapshot{}, xerrors.Errorf("failed to take a consistent snapshot of %s: %w", dbPath, lastErr)
+}
+
+func copyFile(src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp("", "boltwiz-snapshot-*.db")
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// openSnapshot opens a copy and checks it. bbolt panics on the pages a
+// torn copy is made of, so the copy is opened and its buckets walked where
+// the panics can be recovered, before tx.Check looks for the corruptions
+// that do not panic. Check runs in a goroutine of its own, where a panic
+// would crash the process: it only reads the pages the walk went through
+// and the freelist, which is loaded when the copy is opened.
+func openSnapshot(path string) (db *bolt.DB, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = xerrors.Errorf("corrupted copy: %v", p)
+		}
+		if err != nil && db != nil {
+			db.Close()
+			db = nil
+		}
+	}()
+	// Pages past the end of the file fault instead of panicking.
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	db, err = bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second, PreLoadFreelist: true})
+	if err != nil {
+		return nil, err
+	}
+	return db, checkSnapshot(db)
+}
+
+// checkSnapshot walks every bucket of a copy, then runs tx.Check.
+func checkSnapshot(db *bolt.DB) error {
+	return db.View(func(tx *bolt.Tx) error {
+		if err := checkBuckets(tx.Cursor(), tx.Bucket); err != nil {
+			return err
+		}
+		// The channel is drained so that the goroutine of Check ends.
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = xerrors.Errorf("corrupted copy: %w", err)
+			}
+		}
+		return checkErr
+	})
+}
+
+func checkBuckets(c *bolt.Cursor, bucket func([]byte) *bolt.Bucket) error {
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			// Values may span overflow pages, the last byte is on the
+			// last one. KeepAlive keeps the read from being optimized away.
+			if len(v) > 0 {
+				runtime.KeepAlive(v[len(v)-1])
+			}
+			continue
+		}
+		b := bucket(k)
+		if b == nil {
+			return xerrors.Errorf("corrupted copy: bucket %x cannot be opened", k)
+		}
+		if err := checkBuckets(b.Cursor(), b.Bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot describes the snapshot being browsed.
+func (r *Repository) Snapshot() (info model.SnapshotInfo, err error) {
+	r.mu.RLock()
+	snap := r.snapshot
+	tx, err := r.db.Begin(false)
+	r.mu.RUnlock()
+	if err != nil {
+		return model.SnapshotInfo{}, err
+	}
+	defer tx.Rollback()
+
+	if snap.path == "" {
+		return model.SnapshotInfo{}, ErrNoSnapshot
+	}
+	return r.snapshotInfo(tx, snap), nil
+}
+
+// RefreshSnapshot copies the database file again and switches to the new
+// copy. The previous copy is removed once the requests still browsing it
+// are done, new requests browse the new one right away.
+func (r *Repository) RefreshSnapshot() (info model.SnapshotInfo, err error) {
+	if !r.snapshotMode() {
+		return model.SnapshotInfo{}, ErrNoSnapshot
+	}
+	db, snap, err := takeSnapshot(r.dbPath)
+	if err != nil {
+		return model.SnapshotInfo{}, err
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		info = r.snapshotInfo(tx, snap)
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		os.Remove(snap.path)
+		return model.SnapshotInfo{}, err
+	}
+
+	r.mu.Lock()
+	oldDB, oldSnap := r.db, r.snapshot
+	r.db, r.snapshot = db, snap
+	r.mu.Unlock()
+	r.watch.notify()
+
+	// Close waits for the transactions open on the previous copy.
+	if err = oldDB.Close(); err != nil {
+		return model.SnapshotInfo{}, xerrors.Errorf("failed to close the previous snapshot: %w", err)
+	}
+	if err = os.Remove(oldSnap.path); err != nil {
+		return model.SnapshotInfo{}, xerrors.Errorf("failed to remove the previous snapshot: %w", err)
+	}
+	return info, nil
+}
+
+func (r *Repository) snapshotMode() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.snapshot.path != ""
+}
+
+// sourceChanged reports whether the database file was written since the
+// snapshot was taken.
+func (r *Repository) sourceChanged() bool {
+	r.mu.RLock()
+	source := r.snapshot.source
+	r.mu.RUnlock()
+
+	fi, err := os.Stat(r.dbPath)
+	return err == nil && (!fi.ModTime().Equal(source.ModTime()) || fi.Size() != source.Size())
+}
+
+func (r *Repository) snapshotInfo(tx *bolt.Tx, snap snapshot) model.SnapshotInfo {
+	return model.SnapshotInfo{
+		Source:  r.dbPath,
+		TakenAt: snap.takenAt,
+		TxID:    tx.ID(),
+		Size:    tx.Size(),
+	}
+}
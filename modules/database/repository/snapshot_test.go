@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// newSnapshotSource writes a database spanning many pages, with nested
+// buckets and values on overflow pages.
+func newSnapshotSource(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"a", "b"} {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 200; i++ {
+				if err = b.Put([]byte(fmt.Sprintf("k%03d", i)), bytes.Repeat([]byte{'v'}, 100)); err != nil {
+					return err
+				}
+			}
+			if err = b.Put([]byte("big"), bytes.Repeat([]byte{'x'}, 10000)); err != nil {
+				return err
+			}
+			sub, err := b.CreateBucket([]byte("sub"))
+			if err != nil {
+				return err
+			}
+			if err = sub.Put([]byte("x"), []byte("y")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	source := newSnapshotSource(t)
+
+	db, snap, err := takeSnapshot(source)
+	if err != nil {
+		t.Fatalf("takeSnapshot() error = %v", err)
+	}
+	defer os.Remove(snap.path)
+	defer db.Close()
+
+	if !db.IsReadOnly() {
+		t.Error("snapshot is not read-only")
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if got := tx.Bucket([]byte("a")).Bucket([]byte("sub")).Get([]byte("x")); string(got) != "y" {
+			t.Errorf("a/sub/x = %q, want %q", got, "y")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTakeSnapshot_corrupted(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	source := newSnapshotSource(t)
+
+	b, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the meta pages, flip everything after them, freelist included.
+	pageSize := os.Getpagesize()
+	for i := 2 * pageSize; i < len(b); i++ {
+		b[i] ^= 0xff
+	}
+	if err = os.WriteFile(source, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewRepository(source, Options{Snapshot: true}); err == nil {
+		t.Fatal("NewRepository() error = nil, want an error")
+	}
+	left, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d snapshot files left behind", len(left))
+	}
+}
+
+func TestOpenSnapshot_check(t *testing.T) {
+	source := newSnapshotSource(t)
+	db, err := bolt.Open(source, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("b"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty the freelist of the latest meta page. Every bucket can still
+	// be read, but the pages of the deleted bucket are neither reachable
+	// nor free anymore.
+	pageSize := int(binary.LittleEndian.Uint32(b[24:]))
+	meta := 16
+	if binary.LittleEndian.Uint64(b[pageSize+64:]) > binary.LittleEndian.Uint64(b[64:]) {
+		meta += pageSize
+	}
+	freelist := int(binary.LittleEndian.Uint64(b[meta+32:])) * pageSize
+	if binary.LittleEndian.Uint16(b[freelist+10:]) == 0 {
+		t.Fatal("the freelist is empty")
+	}
+	binary.LittleEndian.PutUint16(b[freelist+10:], 0)
+	if err = os.WriteFile(source, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = openSnapshot(source)
+	if err == nil {
+		db.Close()
+		t.Fatal("openSnapshot() error = nil, want an error")
+	}
+	if !strings.Contains(err.Error(), "unreachable unfreed") {
+		t.Errorf("openSnapshot() error = %v, want an unreachable page", err)
+	}
+}
+
+func TestRefreshSnapshot_inFlightRead(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	source := newSnapshotSource(t)
+
+	r, err := NewRepository(source, Options{Snapshot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Hold a read transaction on the first snapshot.
+	reading, release := make(chan struct{}), make(chan struct{})
+	streamed := make(chan error, 1)
+	go func() {
+		first := true
+		_, err := r.StreamElements(context.Background(), model.ListElemReqBody{LevelStack: []string{"a"}}, func(model.Result) error {
+			if first {
+				first = false
+				close(reading)
+				<-release
+			}
+			return nil
+		})
+		streamed <- err
+	}()
+	<-reading
+
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := r.RefreshSnapshot()
+		refreshed <- err
+	}()
+
+	// Other requests go on while the refresh waits for the stream.
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.GetElement(model.ItemToGet{LevelStack: []string{"b", "sub"}, Key: "x"})
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("GetElement() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetElement() blocked behind the refresh")
+	}
+
+	close(release)
+	if err = <-streamed; err != nil {
+		t.Errorf("StreamElements() error = %v", err)
+	}
+	if err = <-refreshed; err != nil {
+		t.Errorf("RefreshSnapshot() error = %v", err)
+	}
+}
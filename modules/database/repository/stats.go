@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// Stats reports the freelist and transaction counters of the database, and
+// the pages used by the bucket at input.LevelStack and by each of its
+// child buckets, nested buckets included. Every page of the buckets is
+// read, so it takes a while on large files.
+func (r *Repository) Stats(input model.StatsReqBody) (stats model.Stats, err error) {
+	db := r.conn()
+
+	if err = input.Encoding.Validate(); err != nil {
+		return model.Stats{}, err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return model.Stats{}, err
+	}
+	format := r.formatFor(path)
+
+	// In snapshot mode, db is the copy. The source file is reported.
+	fi, err := os.Stat(r.dbPath)
+	if err != nil {
+		return model.Stats{}, xerrors.Errorf("failed to stat db: %w", err)
+	}
+	dbStats := db.Stats()
+	stats = model.Stats{
+		LevelStack: input.LevelStack,
+		FileSize:   fi.Size(),
+		PageSize:   db.Info().PageSize,
+		DB: model.DBStats{
+			FreePageN:     dbStats.FreePageN,
+			PendingPageN:  dbStats.PendingPageN,
+			FreeAlloc:     dbStats.FreeAlloc,
+			FreelistInuse: dbStats.FreelistInuse,
+			TxN:           dbStats.TxN,
+			OpenTxN:       dbStats.OpenTxN,
+		},
+		Children: []model.NamedBucketStats{},
+	}
+
+	err = r.view(func(tx *bolt.Tx) error {
+		stats.TxID = tx.ID()
+		stats.Size = tx.Size()
+
+		var total bolt.BucketStats
+		var c *bolt.Cursor
+		child := tx.Bucket
+		if len(path.stack) > 0 {
+			b, err := findBucket(tx, path)
+			if err != nil {
+				return err
+			}
+			total = b.Stats()
+			c = b.Cursor()
+			child = b.Bucket
+		} else {
+			c = tx.Cursor()
+		}
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v != nil {
+				continue
+			}
+			s := child(k).Stats()
+			if len(path.stack) == 0 {
+				// The root is not a bucket, its statistics are the sum of
+				// the top-level ones.
+				total.Add(s)
+			}
+			if len(stats.Children) == maxPageSize {
+				stats.ChildrenTruncated = true
+				if len(path.stack) > 0 {
+					break
+				}
+				continue
+			}
+			name, keyCodec := format.displayKey(input.Encoding, k)
+			stats.Children = append(stats.Children, model.NamedBucketStats{
+				Name:        name,
+				KeyCodec:    keyCodec,
+				BucketStats: bucketStats(s),
+			})
+		}
+		stats.Bucket = bucketStats(total)
+		return nil
+	})
+	if err != nil {
+		return model.Stats{}, err
+	}
+	return stats, nil
+}
+
+func bucketStats(s bolt.BucketStats) model.BucketStats {
+	return model.BucketStats{
+		BranchPageN:       s.BranchPageN,
+		BranchOverflowN:   s.BranchOverflowN,
+		LeafPageN:         s.LeafPageN,
+		LeafOverflowN:     s.LeafOverflowN,
+		KeyN:              s.KeyN,
+		Depth:             s.Depth,
+		BranchAlloc:       s.BranchAlloc,
+		BranchInuse:       s.BranchInuse,
+		LeafAlloc:         s.LeafAlloc,
+		LeafInuse:         s.LeafInuse,
+		BucketN:           s.BucketN,
+		InlineBucketN:     s.InlineBucketN,
+		InlineBucketInuse: s.InlineBucketInuse,
+	}
+}
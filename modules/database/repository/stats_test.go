@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"users", "removed"} {
+			b, err := createBuckets(tx, name)
+			if err != nil {
+				return err
+			}
+			if err = putKeys(b, "key", 100, bytes.Repeat([]byte{'v'}, 100)); err != nil {
+				return err
+			}
+		}
+		_, err := createBuckets(tx, "users", "archived")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pages of the removed bucket are freed once the next transaction
+	// commits.
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("removed"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Update(func(*bolt.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []Options{{}, {ReadOnly: true}} {
+		t.Run(fmt.Sprintf("read-only %v", opts.ReadOnly), func(t *testing.T) {
+			r, err := NewRepository(path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			stats, err := r.Stats(model.StatsReqBody{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.FileSize != fi.Size() {
+				t.Errorf("FileSize = %d, want %d", stats.FileSize, fi.Size())
+			}
+			if stats.DB.FreePageN == 0 {
+				t.Error("FreePageN = 0, want the pages of the removed bucket")
+			}
+			if len(stats.Children) != 1 || stats.Children[0].Name != "users" {
+				t.Fatalf("children = %+v, want users", stats.Children)
+			}
+			if got := stats.Children[0].KeyN; got != 101 {
+				t.Errorf("users keys = %d, want 101", got)
+			}
+			if got := stats.Children[0].BucketN; got != 2 {
+				t.Errorf("users buckets = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestStats_snapshot(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	source := newSnapshotSource(t)
+	r, err := NewRepository(source, Options{Snapshot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Grow the source past the snapshot.
+	db, err := bolt.Open(source, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("c"))
+		if err != nil {
+			return err
+		}
+		return putKeys(b, "key", 1000, bytes.Repeat([]byte{'v'}, 1000))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := r.Stats(model.StatsReqBody{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FileSize != fi.Size() {
+		t.Errorf("FileSize = %d, want the size of the source, %d", stats.FileSize, fi.Size())
+	}
+	if len(stats.Children) != 2 {
+		t.Errorf("children = %+v, want the buckets of the snapshot", stats.Children)
+	}
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/codec"
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// bucketFormat is how the keys and values of a bucket are stored. Values
+// are a codec, wrapped in an optional compression, wrapped in an optional
+// cipher. Nil codec and compression are detected from each value, a nil
+// cipher means the values are not encrypted and a nil key codec means the
+// keys are shown as stored.
+type bucketFormat struct {
+	codec       codec.Codec
+	compression codec.Compression
+	cipher      codec.Cipher
+	key         codec.KeyCodec
+}
+
+// decodedValue is a stored value rendered for a response.
+type decodedValue struct {
+	value string
+	// codec and compression name the formats the value was decoded from.
+	codec       string
+	compression string
+	encrypted   bool
+}
+
+// formatFor returns the format of the keys and values stored under path.
+func (r *Repository) formatFor(path bucketPath) bucketFormat {
+	return bucketFormat{
+		codec:       r.codecs.Bucket(path.names),
+		compression: r.codecs.BucketCompression(path.names),
+		cipher:      r.codecs.BucketCipher(path.names),
+		key:         r.codecs.BucketKey(path.names),
+	}
+}
+
+// decodeValue renders a stored value for a response. Binary encodings
+// return the stored bytes untouched so that they can be written back.
+func (r *Repository) decodeValue(f bucketFormat, enc model.Encoding, v []byte) decodedValue {
+	if enc.IsBinary() {
+		return decodedValue{value: enc.EncodeToString(v)}
+	}
+
+	var out decodedValue
+	if f.cipher != nil {
+		out.encrypted = true
+		plain, err := f.cipher.Decrypt(v)
+		if err != nil {
+			out.value = err.Error()
+			return out
+		}
+		v = plain
+	}
+
+	comp, plain := f.compression, v
+	if comp == nil {
+		comp, plain = r.detectCompression(v)
+	} else {
+		var err error
+		if plain, err = comp.Decompress(v); err != nil {
+			out.compression = comp.Name()
+			out.value = fmt.Sprintf("failed to decompress value as %s: %v", comp.Name(), err)
+			return out
+		}
+	}
+	if comp != codec.None {
+		out.compression = comp.Name()
+	}
+
+	c := f.codec
+	if c == nil {
+		c = r.codecs.Detect(plain)
+	}
+	out.codec = c.Name()
+	var err error
+	if out.value, err = c.Decode(plain); err != nil {
+		out.value = fmt.Sprintf("failed to decode value as %s: %v", c.Name(), err)
+	}
+	return out
+}
+
+// encodeValue is the inverse of decodeValue and returns the bytes to store.
+// stored is the current value, if any, and picks the codec and compression
+// of buckets where they are detected, so that edits keep the stored format.
+func (r *Repository) encodeValue(f bucketFormat, enc model.Encoding, value interface{}, stored []byte) ([]byte, error) {
+	if enc.IsBinary() {
+		s, ok := value.(string)
+		if !ok {
+			return nil, xerrors.Errorf("value must be a %s string", enc)
+		}
+		return enc.DecodeString(s)
+	}
+
+	if f.cipher != nil && stored != nil {
+		plain, err := f.cipher.Decrypt(stored)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decrypt the stored value: %w", err)
+		}
+		stored = plain
+	}
+
+	comp, plain := f.compression, stored
+	switch {
+	case stored == nil:
+		if comp == nil {
+			comp = codec.None
+		}
+	case comp == nil:
+		comp, plain = r.detectCompression(stored)
+	case f.codec == nil:
+		var err error
+		if plain, err = comp.Decompress(stored); err != nil {
+			return nil, xerrors.Errorf("failed to decompress the stored value as %s: %w", comp.Name(), err)
+		}
+	}
+	c := f.codec
+	if c == nil && stored == nil {
+		c = codec.Raw
+	} else if c == nil {
+		c = r.codecs.Detect(plain)
+	}
+
+	val, err := c.Encode(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to marshal the value %v", value)
+	}
+	if val, err = comp.Compress(val); err != nil {
+		return nil, xerrors.Errorf("failed to compress value as %s: %w", comp.Name(), err)
+	}
+	if f.cipher != nil {
+		if val, err = f.cipher.Encrypt(val); err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
+
+// detectCompression returns the compression of a value in a bucket without
+// a configured one, and the decompressed value. Magic bytes can match by
+// chance, so a value that does not decompress is taken as uncompressed.
+func (r *Repository) detectCompression(v []byte) (codec.Compression, []byte) {
+	comp := r.codecs.DetectCompression(v)
+	plain, err := comp.Decompress(v)
+	if err != nil {
+		return codec.None, v
+	}
+	return comp, plain
+}
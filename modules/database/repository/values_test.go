@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/codec"
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// TestCompressionFalsePositive checks that a value starting with the gzip
+// magic bytes by chance is read and written as the uncompressed value it
+// is, unless the bucket is mapped to gzip.
+func TestCompressionFalsePositive(t *testing.T) {
+	notGzip := []byte("\x1f\x8bnot gzip")
+	gzipped, err := codec.Gzip.Compress([]byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRepository(t, Options{
+		CodecMappings:       []string{"mapped=raw"},
+		CompressionMappings: []string{"explicit=gzip"},
+	}, func(tx *bolt.Tx) error {
+		for _, name := range []string{"detected", "mapped", "explicit"} {
+			b, err := createBuckets(tx, name)
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte("k"), notGzip); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte("detected")).Put([]byte("gzipped"), gzipped)
+	})
+
+	tests := []struct {
+		name            string
+		bucket          string
+		key             string
+		wantValue       string
+		wantCompression string
+		wantStored      func(t *testing.T, stored []byte)
+		wantUpdateErr   bool
+	}{
+		{
+			name:       "detected",
+			bucket:     "detected",
+			key:        "k",
+			wantValue:  string(notGzip),
+			wantStored: storedAs([]byte(`"new"`)),
+		},
+		{
+			name:       "codec mapped",
+			bucket:     "mapped",
+			key:        "k",
+			wantValue:  string(notGzip),
+			wantStored: storedAs([]byte(`"new"`)),
+		},
+		{
+			name:            "gzip",
+			bucket:          "detected",
+			key:             "gzipped",
+			wantValue:       `{"a":1}`,
+			wantCompression: "gzip",
+			wantStored: func(t *testing.T, stored []byte) {
+				plain, err := codec.Gzip.Decompress(stored)
+				if err != nil || string(plain) != `"new"` {
+					t.Errorf("stored value = %q, %v, want gzipped %q", plain, err, `"new"`)
+				}
+			},
+		},
+		{
+			name:            "compression mapped",
+			bucket:          "explicit",
+			key:             "k",
+			wantValue:       "failed to decompress value as gzip",
+			wantCompression: "gzip",
+			wantUpdateErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elem, err := r.GetElement(model.ItemToGet{LevelStack: []string{tt.bucket}, Key: tt.key})
+			if err != nil {
+				t.Fatalf("GetElement() error = %v", err)
+			}
+			if !strings.HasPrefix(elem.Value, tt.wantValue) {
+				t.Errorf("GetElement() value = %q, want %q", elem.Value, tt.wantValue)
+			}
+			if elem.Compression != tt.wantCompression {
+				t.Errorf("GetElement() compression = %q, want %q", elem.Compression, tt.wantCompression)
+			}
+
+			err = r.UpdatePairValue(model.ItemToUpdate{LevelStack: []string{tt.bucket}, Key: tt.key, NewValue: "new"})
+			if (err != nil) != tt.wantUpdateErr {
+				t.Fatalf("UpdatePairValue() error = %v, wantErr %v", err, tt.wantUpdateErr)
+			}
+			if tt.wantStored == nil {
+				return
+			}
+			err = r.view(func(tx *bolt.Tx) error {
+				tt.wantStored(t, tx.Bucket([]byte(tt.bucket)).Get([]byte(tt.key)))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func storedAs(want []byte) func(t *testing.T, stored []byte) {
+	return func(t *testing.T, stored []byte) {
+		if !bytes.Equal(stored, want) {
+			t.Errorf("stored value = %q, want %q", stored, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// excerptContext is the number of characters kept on each side of a match.
+const excerptContext = 40
+
+// valueMatcher returns the excerpt of a decoded value matching a value
+// search, or nil when it does not match.
+type valueMatcher func(value string) *model.Excerpt
+
+func newValueMatcher(s model.ValueSearch) (valueMatcher, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	switch s.Mode {
+	case model.ValueMatchField:
+		want, err := decodeJSON(s.Term)
+		if err != nil {
+			want = s.Term
+		}
+		path := strings.Split(s.Path, ".")
+		return func(value string) *model.Excerpt {
+			doc, err := decodeJSON(value)
+			if err != nil {
+				return nil
+			}
+			got, ok := lookupField(doc, path)
+			if !ok || !jsonEqual(got, want) {
+				return nil
+			}
+			b, _ := json.Marshal(got)
+			return &model.Excerpt{Before: s.Path + ": ", Match: string(b)}
+		}, nil
+	case model.ValueMatchRegex:
+		re, err := regexp.Compile(s.Term)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid regular expression %q: %w", s.Term, err)
+		}
+		return regexpMatcher(re), nil
+	}
+	// Matching case-insensitively with a regular expression keeps the
+	// offsets valid for the original value.
+	return regexpMatcher(regexp.MustCompile("(?i)" + regexp.QuoteMeta(s.Term))), nil
+}
+
+func regexpMatcher(re *regexp.Regexp) valueMatcher {
+	return func(value string) *model.Excerpt {
+		loc := re.FindStringIndex(value)
+		if loc == nil {
+			return nil
+		}
+		return excerpt(value, loc[0], loc[1])
+	}
+}
+
+// excerpt cuts value[start:end] out of value with up to excerptContext
+// characters around it, marking truncated sides with an ellipsis.
+func excerpt(value string, start, end int) *model.Excerpt {
+	before := []rune(value[:start])
+	after := []rune(value[end:])
+	e := &model.Excerpt{Before: string(before), Match: value[start:end], After: string(after)}
+	if len(before) > excerptContext {
+		e.Before = "…" + string(before[len(before)-excerptContext:])
+	}
+	if len(after) > excerptContext {
+		e.After = string(after[:excerptContext]) + "…"
+	}
+	return e
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as json.Number
+// so that integers above 2^53 are not rounded into their neighbours.
+func decodeJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, xerrors.New("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+// numberPrec is the precision numbers are compared with, exact for
+// integers of up to 512 bits.
+const numberPrec = 512
+
+// jsonEqual compares values decoded by decodeJSON. Numbers are compared by
+// value with numberPrec bits, so 30 equals 30.0 but 9007199254740993 does
+// not equal 9007199254740992.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Float).SetPrec(numberPrec).SetString(a.String())
+		y, okY := new(big.Float).SetPrec(numberPrec).SetString(b.String())
+		if !okX || !okY {
+			return a == b
+		}
+		return x.Cmp(y) == 0
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// lookupField follows a field path through decoded JSON, where numeric
+// segments index arrays.
+func lookupField(doc interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			field, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			doc = field
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+func TestValueMatcher_field(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		term  string
+		value string
+		want  bool
+	}{
+		{name: "string", path: "email", term: `"bob@example.com"`, value: `{"email":"bob@example.com"}`, want: true},
+		{name: "unquoted string", path: "email", term: `bob@example.com`, value: `{"email":"bob@example.com"}`, want: true},
+		{name: "other string", path: "email", term: `"bob@example.com"`, value: `{"email":"alice@example.com"}`},
+		{name: "array index", path: "emails.1", term: `"b"`, value: `{"emails":["a","b"]}`, want: true},
+		{name: "missing field", path: "age", term: `30`, value: `{"name":"bob"}`},
+		{name: "number", path: "age", term: `30`, value: `{"age":30}`, want: true},
+		{name: "number forms", path: "age", term: `30`, value: `{"age":30.0}`, want: true},
+		{name: "id above 2^53", path: "id", term: `9007199254740993`, value: `{"id":9007199254740993}`, want: true},
+		{name: "neighbour above 2^53", path: "id", term: `9007199254740993`, value: `{"id":9007199254740992}`},
+		{name: "uint64", path: "id", term: `18446744073709551615`, value: `{"id":18446744073709551614}`},
+		{name: "object", path: "user", term: `{"id":1,"tags":["a"]}`, value: `{"user":{"tags":["a"],"id":1.0}}`, want: true},
+		{name: "number and string", path: "id", term: `1`, value: `{"id":"1"}`},
+		{name: "not json", path: "id", term: `1`, value: `id=1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := newValueMatcher(model.ValueSearch{Mode: model.ValueMatchField, Path: tt.path, Term: tt.term})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match(tt.value) != nil; got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
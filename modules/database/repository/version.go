@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"golang.org/x/xerrors"
+)
+
+// versionOf returns the version token of a stored value, a hash of its
+// bytes.
+func versionOf(v []byte) string {
+	sum := sha256.Sum256(v)
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkVersion fails with ErrConflict when ifMatch is set and is not the
+// version of current. Buckets and missing keys, whose current value is nil,
+// never match.
+func checkVersion(ifMatch, name string, current []byte) error {
+	if ifMatch == "" {
+		return nil
+	}
+	if current == nil || versionOf(current) != ifMatch {
+		return xerrors.Errorf("%s has changed since it was read: %w", name, ErrConflict)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+const (
+	// maxWatchedKeys bounds the memory kept per watcher, the watched
+	// bucket is read again after every commit.
+	maxWatchedKeys = 100000
+	// watchDebounce groups the file events of a commit.
+	watchDebounce = 100 * time.Millisecond
+	// watchPollInterval is how often the file is polled next to file
+	// events, which can be missed. Without file events it is polled every
+	// fallbackPollInterval.
+	watchPollInterval    = 5 * time.Second
+	fallbackPollInterval = time.Second
+)
+
+// watchHub notifies the watchers when a transaction is committed. A single
+// file watcher is shared by all of them, and runs while there is one.
+type watchHub struct {
+	mu   sync.Mutex
+	subs map[*watchSub]struct{}
+	stop chan struct{}
+}
+
+// watchSub is a watcher of a watchHub. commits receives a value after each
+// commit, and stale when the source file of a snapshot changed. The values
+// sent before the previous one is received are merged.
+type watchSub struct {
+	commits chan struct{}
+	stale   chan struct{}
+}
+
+// subscribe adds a watcher, until the returned function is called.
+func (h *watchHub) subscribe(r *Repository) (*watchSub, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &watchSub{commits: make(chan struct{}, 1), stale: make(chan struct{}, 1)}
+	if h.subs == nil {
+		h.subs = make(map[*watchSub]struct{})
+	}
+	h.subs[sub] = struct{}{}
+	if h.stop == nil {
+		h.stop = make(chan struct{})
+		// The transaction ID is read before returning, so that the commits
+		// made once the watcher is subscribed are not missed.
+		last, _ := r.TxID()
+		go h.run(r, h.stop, last)
+	}
+	return sub, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, sub)
+		if len(h.subs) == 0 && h.stop != nil {
+			close(h.stop)
+			h.stop = nil
+		}
+	}
+}
+
+func (h *watchHub) notify() {
+	h.send(func(sub *watchSub) chan struct{} { return sub.commits })
+}
+
+func (h *watchHub) notifyStale() {
+	h.send(func(sub *watchSub) chan struct{} { return sub.stale })
+}
+
+func (h *watchHub) send(ch func(*watchSub) chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		select {
+		case ch(sub) <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run notifies the watchers when the transaction ID changed after the
+// database file was written. In snapshot mode, it tells them once when the
+// source file changed since the snapshot was taken: refreshing is left to
+// POST /snapshot/refresh, as copying the file on every commit of a busy
+// writer is costly. The file events are only a hint, so the directory is
+// watched to survive the file being replaced, and the file is polled
+// anyway.
+func (h *watchHub) run(r *Repository, stop <-chan struct{}, last int) {
+	interval := fallbackPollInterval
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if w, err := fsnotify.NewWatcher(); err == nil {
+		defer w.Close()
+		if err = w.Add(filepath.Dir(r.dbPath)); err == nil {
+			events, errs = w.Events, w.Errors
+			interval = watchPollInterval
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stale := false
+	check := func() {
+		if r.snapshotMode() {
+			// The source stays changed until the snapshot is refreshed.
+			changed := r.sourceChanged()
+			if changed && !stale {
+				h.notifyStale()
+			}
+			stale = changed
+			return
+		}
+		if id, err := r.TxID(); err == nil && id != last {
+			last = id
+			h.notify()
+		}
+	}
+	// Commits made before the file was watched are looked for right away.
+	check()
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+			} else if filepath.Clean(ev.Name) == filepath.Clean(r.dbPath) && debounce == nil {
+				debounce = time.After(watchDebounce)
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+			}
+		case <-debounce:
+			debounce = nil
+			check()
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// watchedKey is the state of a key between two reads of a watched bucket.
+type watchedKey struct {
+	bucket  bool
+	version string
+}
+
+// Watch passes the changes of the bucket at input.LevelStack to emit as
+// other transactions are committed, starting with a WatchReady event. In
+// snapshot mode, a WatchStale event tells when the source file changed
+// since the snapshot was taken. It returns ErrNotFound when the bucket
+// does not exist; a bucket deleted later reports all its keys as removed.
+// It stops when ctx is cancelled or emit fails.
+func (r *Repository) Watch(ctx context.Context, input model.WatchReqBody, emit func(model.WatchEvent) error) error {
+	if err := input.Encoding.Validate(); err != nil {
+		return err
+	}
+	path, err := r.resolvePath(input.Encoding, input.LevelStack)
+	if err != nil {
+		return err
+	}
+	format := r.formatFor(path)
+
+	// Subscribe first, so that no commit is missed between the first read
+	// and the first notification.
+	sub, cancel := r.watch.subscribe(r)
+	defer cancel()
+
+	state, txID, _, err := r.diffBucket(path, format, input.Encoding, nil)
+	if err != nil {
+		return err
+	}
+	if err = emit(model.WatchEvent{Type: model.WatchReady, TxID: txID}); err != nil {
+		return err
+	}
+	// The hub only tells when the snapshot becomes stale, which may have
+	// happened before this watch.
+	if r.snapshotMode() && r.sourceChanged() {
+		if err = emit(model.WatchEvent{Type: model.WatchStale, TxID: txID}); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sub.stale:
+			if err = emit(model.WatchEvent{Type: model.WatchStale, TxID: txID}); err != nil {
+				return err
+			}
+			continue
+		case <-sub.commits:
+		}
+		var changes []model.WatchEvent
+		state, txID, changes, err = r.diffBucket(path, format, input.Encoding, state)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			change.TxID = txID
+			if err = emit(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// diffBucket reads the keys of the bucket at path and returns the changes
+// since prev. The first read, without prev, fails when the bucket does not
+// exist and returns no change.
+func (r *Repository) diffBucket(path bucketPath, format bucketFormat, enc model.Encoding, prev map[string]watchedKey) (
+	next map[string]watchedKey, txID int, changes []model.WatchEvent, err error) {
+	next = make(map[string]watchedKey, len(prev))
+	err = r.view(func(tx *bolt.Tx) error {
+		txID = tx.ID()
+		var c *bolt.Cursor
+		if len(path.stack) > 0 {
+			b, err := findBucket(tx, path)
+			if xerrors.Is(err, ErrNotFound) && prev != nil {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			c = b.Cursor()
+		} else {
+			c = tx.Cursor()
+		}
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if len(next) == maxWatchedKeys {
+				return xerrors.Errorf("more than %d keys to watch, watch a nested bucket instead", maxWatchedKeys)
+			}
+			key := watchedKey{bucket: v == nil}
+			if v != nil {
+				key.version = versionOf(v)
+			}
+			next[string(k)] = key
+			if prev == nil {
+				continue
+			}
+			old, ok := prev[string(k)]
+			if ok && old == key {
+				continue
+			}
+			event := model.WatchEvent{Type: model.WatchChanged}
+			if !ok {
+				event.Type = model.WatchAdded
+			}
+			result := r.newResult(format, enc, k, v)
+			event.Result = &result
+			changes = append(changes, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var removed []string
+	for k := range prev {
+		if _, ok := next[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	for _, k := range removed {
+		name, keyCodec := format.displayKey(enc, []byte(k))
+		changes = append(changes, model.WatchEvent{
+			Type: model.WatchRemoved,
+			Result: &model.Result{
+				Name:     name,
+				IsBucket: prev[k].bucket,
+				KeyCodec: keyCodec,
+			},
+		})
+	}
+	return next, txID, changes, nil
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/model"
+)
+
+// watchEvents starts watching input and returns the events after the
+// ready one.
+func watchEvents(t *testing.T, r *Repository, input model.WatchReqBody) <-chan model.WatchEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan model.WatchEvent, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Watch(ctx, input, func(event model.WatchEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if event := nextEvent(t, events); event.Type != model.WatchReady {
+		t.Fatalf("first event = %s, want %s", event.Type, model.WatchReady)
+	}
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan model.WatchEvent) model.WatchEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event")
+	}
+	return model.WatchEvent{}
+}
+
+// received reports whether ch receives a value within d.
+func received(ch <-chan struct{}, d time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func TestWatchHub_subscribe(t *testing.T) {
+	r := newTestRepository(t, Options{}, nil)
+	h := &r.watch
+
+	running := func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.stop != nil
+	}
+	sub1, cancel1 := h.subscribe(r)
+	sub2, cancel2 := h.subscribe(r)
+	if !running() {
+		t.Fatal("the hub is not running with two watchers")
+	}
+
+	// Notifications are merged until they are received.
+	h.notify()
+	h.notify()
+	for i, sub := range []*watchSub{sub1, sub2} {
+		if !received(sub.commits, time.Second) {
+			t.Errorf("watcher %d was not notified", i+1)
+		}
+		if received(sub.commits, 0) {
+			t.Errorf("watcher %d was notified twice", i+1)
+		}
+		if received(sub.stale, 0) {
+			t.Errorf("watcher %d was told the snapshot is stale", i+1)
+		}
+	}
+
+	cancel1()
+	if !running() {
+		t.Fatal("the hub stopped with a watcher left")
+	}
+	h.notify()
+	if received(sub1.commits, 100*time.Millisecond) {
+		t.Error("an unsubscribed watcher was notified")
+	}
+	if !received(sub2.commits, time.Second) {
+		t.Error("the remaining watcher was not notified")
+	}
+	cancel2()
+	if running() {
+		t.Error("the hub is running without watchers")
+	}
+}
+
+func TestWatchHub_debounce(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte("users"))
+		return err
+	})
+	sub, cancel := r.watch.subscribe(r)
+	defer cancel()
+	// Let the hub start watching the file.
+	time.Sleep(100 * time.Millisecond)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		err := r.AddPairs(model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: key, Value: 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !received(sub.commits, 10*time.Second) {
+		t.Fatal("no notification after the commits")
+	}
+	if received(sub.commits, 500*time.Millisecond) {
+		t.Error("the commits were notified more than once")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	r := newTestRepository(t, Options{}, func(tx *bolt.Tx) error {
+		b, err := createBuckets(tx, "users")
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{"alice", "bob"} {
+			if err = b.Put([]byte(key), []byte("1")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	events := watchEvents(t, r, model.WatchReqBody{LevelStack: []string{"users"}})
+
+	_, err := r.Batch(model.BatchReqBody{Operations: []model.BatchOp{
+		{Update: &model.ItemToUpdate{LevelStack: []string{"users"}, Key: "alice", NewValue: 2}},
+		{Delete: &model.ItemToDelete{LevelStack: []string{"users"}, Key: "bob"}},
+		{Put: &model.PairsToAdd{LevelStack: []string{"users"}, Pairs: []model.Pair{{Key: "carol", Value: 3}}}},
+		{CreateBucket: &model.BucketsToAdd{LevelStack: []string{"users"}, Buckets: []string{"archived"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []model.WatchEvent{
+		{Type: model.WatchChanged, Result: &model.Result{Name: "alice", Value: "2", Codec: "raw", Version: versionOf([]byte("2"))}},
+		{Type: model.WatchAdded, Result: &model.Result{Name: "archived", IsBucket: true}},
+		{Type: model.WatchAdded, Result: &model.Result{Name: "carol", Value: "3", Codec: "raw", Version: versionOf([]byte("3"))}},
+		{Type: model.WatchRemoved, Result: &model.Result{Name: "bob"}},
+	}
+	txID, err := r.TxID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range want {
+		w.TxID = txID
+		if got := nextEvent(t, events); !reflect.DeepEqual(got, w) {
+			t.Errorf("event = %+v %+v, want %+v %+v", got, got.Result, w, w.Result)
+		}
+	}
+}
+
+func TestWatch_staleSnapshot(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	source := newSnapshotSource(t)
+	r, err := NewRepository(source, Options{Snapshot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	events := watchEvents(t, r, model.WatchReqBody{LevelStack: []string{"a", "sub"}})
+	before, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot does not lock the source.
+	db, err := bolt.Open(source, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("a")).Bucket([]byte("sub")).Put([]byte("y"), []byte("z"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := nextEvent(t, events); event.Type != model.WatchStale || event.TxID != before.TxID {
+		t.Fatalf("event = %s in %d, want %s in %d", event.Type, event.TxID, model.WatchStale, before.TxID)
+	}
+	after, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("snapshot = %+v, want it left as %+v", after, before)
+	}
+
+	// A new watch is told right away.
+	late := watchEvents(t, r, model.WatchReqBody{})
+	if event := nextEvent(t, late); event.Type != model.WatchStale {
+		t.Errorf("event of a new watch = %s, want %s", event.Type, model.WatchStale)
+	}
+
+	if _, err = r.RefreshSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Type != model.WatchAdded || event.Name != "y" {
+		t.Errorf("event after the refresh = %s %+v, want y %s", event.Type, event.Result, model.WatchAdded)
+	}
+}
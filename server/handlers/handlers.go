@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/labstack/gommon/log"
 
@@ -25,34 +32,322 @@ func NewHandlers(repo *repository.Repository) *Handlers {
 	return &Handlers{repo: repo}
 }
 
+// Writable rejects write requests with 403 Forbidden when the database is
+// opened read-only.
+func (h *Handlers) Writable(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if h.repo.ReadOnly() {
+			return echo.NewHTTPError(http.StatusForbidden, "The database is opened read-only")
+		}
+		return next(c)
+	}
+}
+
+// unmarshalValues decodes a request carrying values, keeping their numbers
+// as json.Number: integers above 2^53 do not survive a float64.
+func unmarshalValues(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
 func (h *Handlers) SayHello(c echo.Context) error {
 	return c.String(200, "Hello from the other side")
 }
 
-func (h *Handlers) ListElement(c echo.Context) error {
+// listRequest reads the body of the list endpoints and completes it with
+// the paging and search query parameters.
+func listRequest(c echo.Context) (model.ListElemReqBody, error) {
 	all, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		return err
+		return model.ListElemReqBody{}, err
 	}
 	var reqBody model.ListElemReqBody
 	err = json.Unmarshal(all, &reqBody)
 	if err != nil {
-		return err
+		return model.ListElemReqBody{}, err
 	}
 	pageSize := utils.ParseInt(c.QueryParam("page_size"))
-	pageNum := utils.ParseInt(c.QueryParam("page"))
+	nextKey := c.QueryParam("next_key")
 	searchKey := c.QueryParam("key")
 	reqBody.PageSize = pageSize
-	reqBody.Page = pageNum
+	reqBody.NextKey = nextKey
 	reqBody.SearchKey = searchKey
+	reqBody.MatchMode = model.MatchMode(c.QueryParam("match"))
+	reqBody.SearchTo = c.QueryParam("key_to")
+	return reqBody, nil
+}
+
+// ListElement tags its response with the ID of the last committed
+// transaction, which changes with every write, and with a hash of the
+// request, since all the listings share the same URL. It answers 304 Not
+// Modified when the client already holds that version.
+func (h *Handlers) ListElement(c echo.Context) error {
+	reqBody, err := listRequest(c)
+	if err != nil {
+		return err
+	}
+	txID, err := h.repo.TxID()
+	if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed Listing element: %v", err))
+	}
+	etag, err := listETag(txID, reqBody)
+	if err != nil {
+		return err
+	}
+	if c.Request().Header.Get("If-None-Match") == etag {
+		c.Response().Header().Set("ETag", etag)
+		return c.NoContent(http.StatusNotModified)
+	}
 	resp, err := h.repo.ListElement(reqBody)
 	if err != nil {
 		log.Error(err)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed Listing element: %v", err))
 	}
+	c.Response().Header().Set("ETag", etag)
+	return c.JSON(http.StatusOK, resp)
+}
+
+func listETag(txID int, reqBody model.ListElemReqBody) (string, error) {
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf(`W/"%d-%x"`, txID, sum[:8]), nil
+}
+
+// GetElement serves both GET and HEAD. The key is addressed through the
+// level_stack (repeated) and key query parameters so that HEAD requests
+// do not need a body.
+func (h *Handlers) GetElement(c echo.Context) error {
+	reqBody := model.ItemToGet{
+		LevelStack: c.QueryParams()["level_stack"],
+		Encoding:   model.Encoding(c.QueryParam("encoding")),
+		Key:        c.QueryParam("key"),
+	}
+	resp, err := h.repo.GetElement(reqBody)
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed fetching element: %v", err))
+	} else if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed fetching element: %v", err))
+	}
+	if c.Request().Method == http.MethodHead {
+		c.Response().Header().Set("X-Is-Bucket", strconv.FormatBool(resp.IsBucket))
+		c.Response().Header().Set("X-Value-Size", strconv.Itoa(resp.Size))
+		return c.NoContent(http.StatusOK)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handlers) CountChildren(c echo.Context) error {
+	all, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	var reqBody model.CountReqBody
+	err = json.Unmarshal(all, &reqBody)
+	if err != nil {
+		return err
+	}
+	resp, err := h.repo.CountChildren(reqBody)
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed counting children: %v", err))
+	} else if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed counting children: %v", err))
+	}
 	return c.JSON(http.StatusOK, resp)
 }
 
+// StreamElements writes the results of a listing as newline-delimited JSON
+// while the bucket is read. Without page_size the whole bucket is listed,
+// otherwise a trailing line carries the next_key of the following page.
+func (h *Handlers) StreamElements(c echo.Context) error {
+	reqBody, err := listRequest(c)
+	if err != nil {
+		return err
+	}
+
+	res := c.Response()
+	enc := json.NewEncoder(res)
+	started := false
+	writeLine := func(line interface{}) error {
+		if !started {
+			res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+			res.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	}
+
+	nextKey, err := h.repo.StreamElements(c.Request().Context(), reqBody, func(result model.Result) error {
+		return writeLine(result)
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The client went away, there is nobody to report to.
+		return nil
+	case err != nil:
+		log.Error(err)
+		if started {
+			return writeLine(model.ListTrailer{Error: err.Error()})
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed Listing element: %v", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed Listing element: %v", err))
+	case nextKey != "":
+		return writeLine(model.ListTrailer{NextKey: nextKey})
+	case !started:
+		// Send the headers of an empty listing.
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		return c.NoContent(http.StatusOK)
+	}
+	return nil
+}
+
+// Search streams its matches as newline-delimited JSON events while the
+// search runs, and ends with the summary.
+func (h *Handlers) Search(c echo.Context) error {
+	all, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	var reqBody model.SearchReqBody
+	err = json.Unmarshal(all, &reqBody)
+	if err != nil {
+		return err
+	}
+
+	res := c.Response()
+	enc := json.NewEncoder(res)
+	started := false
+	writeEvent := func(event model.SearchEvent) error {
+		if !started {
+			res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+			res.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	}
+
+	summary, err := h.repo.Search(c.Request().Context(), reqBody, func(match model.SearchMatch) error {
+		return writeEvent(model.SearchEvent{Match: &match})
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	} else if err != nil {
+		log.Error(err)
+		if started {
+			return writeEvent(model.SearchEvent{Error: err.Error()})
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed searching: %v", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed searching: %v", err))
+	}
+	return writeEvent(model.SearchEvent{Summary: &summary})
+}
+
+// sseKeepAlive is how often a comment is sent on idle event streams, so
+// that proxies keep them open.
+const sseKeepAlive = 30 * time.Second
+
+// Watch streams the changes of a bucket as Server-Sent Events named after
+// their type. Being meant for EventSource, it takes the level stack and
+// encoding as query parameters.
+func (h *Handlers) Watch(c echo.Context) error {
+	reqBody := model.WatchReqBody{
+		LevelStack: c.QueryParams()["level_stack"],
+		Encoding:   model.Encoding(c.QueryParam("encoding")),
+	}
+
+	res := c.Response()
+	var mu sync.Mutex
+	started := false
+	write := func(event, id string, data any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !started {
+			res.Header().Set(echo.HeaderContentType, "text/event-stream")
+			res.Header().Set(echo.HeaderCacheControl, "no-cache")
+			res.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if event == "" {
+			// A comment, ignored by the clients.
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+		} else {
+			b, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if id != "" {
+				if _, err = fmt.Fprintf(res, "id: %s\n", id); err != nil {
+					return err
+				}
+			}
+			if _, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, b); err != nil {
+				return err
+			}
+		}
+		res.Flush()
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(sseKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				open := started
+				mu.Unlock()
+				if open && write("", "", nil) != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := h.repo.Watch(ctx, reqBody, func(event model.WatchEvent) error {
+		return write(string(event.Type), strconv.Itoa(event.TxID), event)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	log.Error(err)
+	mu.Lock()
+	wasStarted := started
+	mu.Unlock()
+	if wasStarted {
+		return write("error", "", model.ListTrailer{Error: err.Error()})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed watching: %v", err))
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed watching: %v", err))
+}
+
 func (h *Handlers) AddBucket(c echo.Context) error {
 	all, err := io.ReadAll(c.Request().Body)
 	if err != nil {
@@ -77,7 +372,7 @@ func (h *Handlers) AddPairs(c echo.Context) error {
 		return err
 	}
 	var reqBody model.PairsToAdd
-	err = json.Unmarshal(all, &reqBody)
+	err = unmarshalValues(all, &reqBody)
 	if err != nil {
 		return err
 	}
@@ -100,7 +395,9 @@ func (h *Handlers) DeleteElement(c echo.Context) error {
 		return err
 	}
 	err = h.repo.DeleteElement(reqBody)
-	if err != nil {
+	if errors.Is(err, repository.ErrConflict) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Failed Deleting element : %v", err))
+	} else if err != nil {
 		log.Error(err)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed Deleting element : %v", err))
 	}
@@ -117,7 +414,9 @@ func (h *Handlers) RenameElement(c echo.Context) error {
 		return err
 	}
 	err = h.repo.RenameElement(reqBody)
-	if err != nil {
+	if errors.Is(err, repository.ErrConflict) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Failed renaming element : %v", err))
+	} else if err != nil {
 		log.Error(err)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed renaming element : %v", err))
 	}
@@ -129,14 +428,109 @@ func (h *Handlers) UpdatePairValue(c echo.Context) error {
 		return err
 	}
 	var reqBody model.ItemToUpdate
-	err = json.Unmarshal(all, &reqBody)
+	err = unmarshalValues(all, &reqBody)
 	if err != nil {
 		return err
 	}
 	err = h.repo.UpdatePairValue(reqBody)
-	if err != nil {
+	if errors.Is(err, repository.ErrConflict) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Failed updating pair value : %v", err))
+	} else if err != nil {
 		log.Error(err)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed updating pair value : %v", err))
 	}
 	return c.JSON(http.StatusOK, "Updated pair value successfully")
 }
+
+func (h *Handlers) CopyElement(c echo.Context) error {
+	all, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	var reqBody model.ItemToCopy
+	err = json.Unmarshal(all, &reqBody)
+	if err != nil {
+		return err
+	}
+	resp, err := h.repo.Copy(reqBody)
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed copying element: %v", err))
+	} else if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed copying element: %v", err))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Batch answers with the result of every operation, including when the
+// batch was rolled back.
+func (h *Handlers) Batch(c echo.Context) error {
+	all, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	var reqBody model.BatchReqBody
+	err = unmarshalValues(all, &reqBody)
+	if err != nil {
+		return err
+	}
+	resp, err := h.repo.Batch(reqBody)
+	if errors.Is(err, repository.ErrInvalid) {
+		return c.JSON(http.StatusBadRequest, resp)
+	} else if errors.Is(err, repository.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, resp)
+	} else if errors.Is(err, repository.ErrConflict) {
+		return c.JSON(http.StatusConflict, resp)
+	} else if err != nil {
+		log.Error(err)
+		return c.JSON(http.StatusInternalServerError, resp)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// GetSnapshot describes the copy browsed in snapshot mode.
+func (h *Handlers) GetSnapshot(c echo.Context) error {
+	resp, err := h.repo.Snapshot()
+	if errors.Is(err, repository.ErrNoSnapshot) {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed fetching snapshot: %v", err))
+	} else if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed fetching snapshot: %v", err))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RefreshSnapshot copies the database file again, so that the changes
+// committed since the last snapshot can be browsed.
+func (h *Handlers) RefreshSnapshot(c echo.Context) error {
+	resp, err := h.repo.RefreshSnapshot()
+	if errors.Is(err, repository.ErrNoSnapshot) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Failed refreshing snapshot: %v", err))
+	} else if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed refreshing snapshot: %v", err))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Stats reports the space used by the file and by the buckets under the
+// requested level stack.
+func (h *Handlers) Stats(c echo.Context) error {
+	all, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	var reqBody model.StatsReqBody
+	err = json.Unmarshal(all, &reqBody)
+	if err != nil {
+		return err
+	}
+	resp, err := h.repo.Stats(reqBody)
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Failed fetching stats: %v", err))
+	} else if err != nil {
+		log.Error(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed fetching stats: %v", err))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
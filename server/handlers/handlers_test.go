@@ -0,0 +1,339 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/knqyf263/boltwiz/modules/database/repository"
+	"github.com/knqyf263/boltwiz/server/handlers"
+	"github.com/knqyf263/boltwiz/server/routes"
+)
+
+// newTestServer serves the API on a new file filled by fill.
+func newTestServer(t *testing.T, opts repository.Options, fill func(tx *bolt.Tx) error) *echo.Echo {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill != nil {
+		if err = db.Update(fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := repository.NewRepository(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	e := echo.New()
+	routes.RegisterV1Routes(e, handlers.NewHandlers(repo))
+	return e
+}
+
+// serve sends a request to e. Headers are given as name, value pairs.
+func serve(e *echo.Echo, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetElement(t *testing.T) {
+	e := newTestServer(t, repository.Options{}, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		if _, err = b.CreateBucket([]byte("settings")); err != nil {
+			return err
+		}
+		return b.Put([]byte("alice"), []byte(`{"age":30}`))
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantBucket string
+		wantSize   string
+	}{
+		{name: "get", method: http.MethodGet, target: "/api/v1/key?level_stack=users&key=alice", wantStatus: http.StatusOK, wantBody: `"value":"{\"age\":30}"`},
+		{name: "head value", method: http.MethodHead, target: "/api/v1/key?level_stack=users&key=alice", wantStatus: http.StatusOK, wantBucket: "false", wantSize: "10"},
+		{name: "head bucket", method: http.MethodHead, target: "/api/v1/key?level_stack=users&key=settings", wantStatus: http.StatusOK, wantBucket: "true", wantSize: "0"},
+		{name: "missing", method: http.MethodGet, target: "/api/v1/key?level_stack=users&key=bob", wantStatus: http.StatusNotFound},
+		{name: "head missing", method: http.MethodHead, target: "/api/v1/key?level_stack=users&key=bob", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(e, tt.method, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rec.Body, tt.wantBody)
+			}
+			if got := rec.Header().Get("X-Is-Bucket"); got != tt.wantBucket {
+				t.Errorf("X-Is-Bucket = %q, want %q", got, tt.wantBucket)
+			}
+			if got := rec.Header().Get("X-Value-Size"); got != tt.wantSize {
+				t.Errorf("X-Value-Size = %q, want %q", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	e := newTestServer(t, repository.Options{}, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		if b, err = b.CreateBucket([]byte("archived")); err != nil {
+			return err
+		}
+		return b.Put([]byte("alice"), []byte(`{"age":30}`))
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantEvents []string
+	}{
+		{
+			name:       "matches then summary",
+			body:       `{"level_stack":[],"search_key":"alice"}`,
+			wantStatus: http.StatusOK,
+			wantEvents: []string{
+				`{"match":{"level_stack":["users","archived"],"name":"alice",`,
+				`{"summary":{"matches":1,"buckets":3}}`,
+			},
+		},
+		{
+			name:       "missing path",
+			body:       `{"level_stack":["groups"],"search_key":"alice"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(e, http.MethodPost, "/api/v1/search", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantEvents == nil {
+				return
+			}
+			if got := rec.Header().Get(echo.HeaderContentType); got != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+			}
+			events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+			if len(events) != len(tt.wantEvents) {
+				t.Fatalf("events = %q, want %d of them", events, len(tt.wantEvents))
+			}
+			for i, want := range tt.wantEvents {
+				if !strings.HasPrefix(events[i], want) {
+					t.Errorf("event %d = %s, want it to start with %s", i, events[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "committed",
+			body:       `{"operations":[{"put":{"level_stack":["users"],"pairs":[{"key":"bob","value":1}]}}]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `"committed":true`,
+		},
+		{
+			name:       "unknown operation",
+			body:       `{"operations":[{"put":{"level_stack":["users"],"pairs":[{"key":"bob","value":1}]}},{}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"committed":false`,
+		},
+		{
+			name:       "missing key",
+			body:       `{"operations":[{"delete":{"level_stack":["users"]}}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"committed":false`,
+		},
+		{
+			name:       "missing bucket",
+			body:       `{"operations":[{"delete":{"level_stack":["groups"],"key":"admins"}}]}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `"committed":false`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestServer(t, repository.Options{}, func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte("users"))
+				return err
+			})
+			rec := serve(e, http.MethodPost, "/api/v1/batch", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListElement_etag(t *testing.T) {
+	e := newTestServer(t, repository.Options{}, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("alice"), []byte(`{"age":30}`))
+	})
+
+	const body = `{"level_stack":["users"]}`
+	rec := serve(e, http.MethodPost, "/api/v1/list", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	rec = serve(e, http.MethodPost, "/api/v1/list", body, "If-None-Match", etag)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag = %q, want %q", got, etag)
+	}
+
+	rec = serve(e, http.MethodPost, "/api/v1/list?key=a", body, "If-None-Match", etag)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status of another listing = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = serve(e, http.MethodPost, "/api/v1/add_pairs", `{"level_stack":["users"],"pairs":[{"key":"bob","value":1}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	rec = serve(e, http.MethodPost, "/api/v1/list", body, "If-None-Match", etag)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status after a write = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("ETag"); got == etag || got == "" {
+		t.Errorf("ETag after a write = %q, want a new one", got)
+	}
+
+	rec = serve(e, http.MethodPost, "/api/v1/list", `{"level_stack":["groups"]}`)
+	if rec.Code == http.StatusOK {
+		t.Fatalf("status of a missing bucket = %d, want an error", rec.Code)
+	}
+	if got := rec.Header().Get("ETag"); got != "" {
+		t.Errorf("ETag of an error = %q, want none", got)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{name: "update", target: "/api/v1/update_value", body: `{"level_stack":["users"],"key":"alice","new_value":{"age":31},"if_match":%q}`},
+		{name: "delete", target: "/api/v1/delete", body: `{"level_stack":["users"],"key":"alice","if_match":%q}`},
+		{name: "rename", target: "/api/v1/rename_key", body: `{"level_stack":["users"],"key":"alice","new_key":"alicia","if_match":%q}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestServer(t, repository.Options{}, func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucket([]byte("users"))
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte("alice"), []byte(`{"age":30}`))
+			})
+			rec := serve(e, http.MethodGet, "/api/v1/key?level_stack=users&key=alice", "")
+			var elem struct {
+				Version string `json:"version"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &elem); err != nil || elem.Version == "" {
+				t.Fatalf("no version in %s: %v", rec.Body, err)
+			}
+
+			rec = serve(e, http.MethodPost, tt.target, fmt.Sprintf(tt.body, "0123456789abcdef"))
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("status with a stale version = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+			}
+			rec = serve(e, http.MethodPost, tt.target, fmt.Sprintf(tt.body, elem.Version))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status with the current version = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			rec = serve(e, http.MethodPost, tt.target, fmt.Sprintf(tt.body, elem.Version))
+			if rec.Code == http.StatusOK {
+				t.Errorf("status when replayed = %d, want an error", rec.Code)
+			}
+		})
+	}
+}
+
+func TestWritable(t *testing.T) {
+	e := newTestServer(t, repository.Options{ReadOnly: true}, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("alice"), []byte(`{"age":30}`))
+	})
+
+	tests := []struct {
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{target: "/api/v1/list", body: `{"level_stack":["users"]}`, wantStatus: http.StatusOK},
+		{target: "/api/v1/add_buckets", body: `{"level_stack":[],"buckets":["groups"]}`, wantStatus: http.StatusForbidden},
+		{target: "/api/v1/add_pairs", body: `{"level_stack":["users"],"pairs":[{"key":"bob","value":1}]}`, wantStatus: http.StatusForbidden},
+		{target: "/api/v1/delete", body: `{"level_stack":["users"],"key":"alice"}`, wantStatus: http.StatusForbidden},
+		{target: "/api/v1/rename_key", body: `{"level_stack":["users"],"key":"alice","new_key":"alicia"}`, wantStatus: http.StatusForbidden},
+		{target: "/api/v1/update_value", body: `{"level_stack":["users"],"key":"alice","new_value":1}`, wantStatus: http.StatusForbidden},
+		{target: "/api/v1/copy", body: `{"level_stack":["users"],"new_level_stack":["backup"]}`, wantStatus: http.StatusForbidden},
+		{target: "/api/v1/batch", body: `{"operations":[]}`, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serve(e, http.MethodPost, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -10,11 +10,22 @@ func RegisterV1Routes(e *echo.Echo, h *handlers.Handlers) {
 	v1 := e.Group("/api/v1")
 	v1.GET("", h.SayHello, can("api"))
 	v1.POST("/list", h.ListElement)
-	v1.POST("/add_buckets", h.AddBucket)
-	v1.POST("/add_pairs", h.AddPairs)
-	v1.POST("/delete", h.DeleteElement)
-	v1.POST("/rename_key", h.RenameElement)
-	v1.POST("/update_value", h.UpdatePairValue)
+	v1.POST("/list/stream", h.StreamElements)
+	v1.POST("/counts", h.CountChildren)
+	v1.POST("/stats", h.Stats)
+	v1.POST("/search", h.Search)
+	v1.GET("/watch", h.Watch)
+	v1.GET("/key", h.GetElement)
+	v1.HEAD("/key", h.GetElement)
+	v1.POST("/add_buckets", h.AddBucket, h.Writable)
+	v1.POST("/add_pairs", h.AddPairs, h.Writable)
+	v1.POST("/delete", h.DeleteElement, h.Writable)
+	v1.POST("/rename_key", h.RenameElement, h.Writable)
+	v1.POST("/update_value", h.UpdatePairValue, h.Writable)
+	v1.POST("/copy", h.CopyElement, h.Writable)
+	v1.POST("/batch", h.Batch, h.Writable)
+	v1.GET("/snapshot", h.GetSnapshot)
+	v1.POST("/snapshot/refresh", h.RefreshSnapshot)
 }
 
 // can checks that the current user's role is allowed to perform all of the
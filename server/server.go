@@ -12,6 +12,7 @@ import (
 
 	"github.com/labstack/echo/v4/middleware"
 
+	"github.com/knqyf263/boltwiz/modules/database/codec"
 	"github.com/knqyf263/boltwiz/modules/database/repository"
 	"github.com/knqyf263/boltwiz/server/handlers"
 	"github.com/knqyf263/boltwiz/server/routes"
@@ -20,14 +21,46 @@ import (
 )
 
 type Options struct {
-	DBPath     string
-	Port       int
-	ProtoFiles []string
-	ProtoType  string
+	DBPath              string
+	Port                int
+	ProtoFiles          []string
+	ProtoType           string
+	ProtoMappings       []string
+	ImportPaths         []string
+	Protosets           []string
+	ProtoWire           bool
+	CodecMappings       []string
+	CompressionMappings []string
+	EncryptionKeyFile   string
+	EncryptionNonce     string
+	EncryptionPatterns  []string
+	KeyMappings         []string
+	ReadOnly            bool
+	LockTimeout         time.Duration
+	Snapshot            bool
+	// Codecs are additional value codecs, for programs embedding boltwiz.
+	Codecs []codec.Codec
 }
 
 func StartServer(opts Options) error {
-	repo, err := repository.NewRepository(opts.DBPath, opts.ProtoType, opts.ProtoFiles)
+	repo, err := repository.NewRepository(opts.DBPath, repository.Options{
+		ProtoType:           opts.ProtoType,
+		ProtoFiles:          opts.ProtoFiles,
+		ProtoMappings:       opts.ProtoMappings,
+		ProtoImportPaths:    opts.ImportPaths,
+		Protosets:           opts.Protosets,
+		ProtoWire:           opts.ProtoWire,
+		Codecs:              opts.Codecs,
+		CodecMappings:       opts.CodecMappings,
+		CompressionMappings: opts.CompressionMappings,
+		EncryptionKeyFile:   opts.EncryptionKeyFile,
+		EncryptionNonce:     opts.EncryptionNonce,
+		EncryptionPatterns:  opts.EncryptionPatterns,
+		KeyMappings:         opts.KeyMappings,
+		ReadOnly:            opts.ReadOnly,
+		LockTimeout:         opts.LockTimeout,
+		Snapshot:            opts.Snapshot,
+	})
 	if err != nil {
 		return err
 	}
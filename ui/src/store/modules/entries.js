@@ -3,6 +3,14 @@ import axios from "axios";
 
 const BASE_URL = process.env.VUE_APP_API_URL || ''
 
+// withRawJSON adds a JSON text to a request without parsing it, since
+// JavaScript numbers round the integers above 2^53.
+function withRawJSON(request, field, text) {
+    return JSON.stringify(request).slice(0, -1) + ',' + JSON.stringify(field) + ':' + text + '}'
+}
+
+const jsonHeaders = {headers: {'Content-Type': 'application/json'}}
+
 export default defineStore('entries', {
     state() {
         return {
@@ -13,11 +21,20 @@ export default defineStore('entries', {
         }
     },
     actions: {
+        // getEntries lists a page of the bucket at request.level_stack.
+        // request.next_key is the next_key of the previous page.
         async getEntries(request) {
-            let url = BASE_URL + '/api/v1/list'
+            const params = new URLSearchParams()
             if (request.filter) {
-                url += '?key=' + request.filter
+                params.set('key', request.filter)
+            }
+            if (request.page_size) {
+                params.set('page_size', request.page_size)
+            }
+            if (request.next_key) {
+                params.set('next_key', request.next_key)
             }
+            const url = BASE_URL + '/api/v1/list?' + params.toString()
 
             this.currentStack = request.stack || []
 
@@ -28,17 +45,43 @@ export default defineStore('entries', {
             this.pageSize = request.pageSize
             return respBody
         },
+        async countChildren(request) {
+            const response = await axios.post(BASE_URL + '/api/v1/counts', request)
+            return response.data
+        },
+        // watchEntries calls onEvent with the changes of the bucket at
+        // stack, until the returned EventSource is closed.
+        watchEntries(stack, onEvent) {
+            const params = new URLSearchParams()
+            stack.forEach((name) => params.append('level_stack', name))
+            const source = new EventSource(BASE_URL + '/api/v1/watch?' + params.toString())
+            const types = ['added', 'removed', 'changed', 'stale']
+            types.forEach((type) => {
+                source.addEventListener(type, (event) => onEvent(JSON.parse(event.data)))
+            })
+            return source
+        },
+        // refreshSnapshot takes a new snapshot in snapshot mode.
+        async refreshSnapshot() {
+            const response = await axios.post(BASE_URL + '/api/v1/snapshot/refresh')
+            return response.data
+        },
         async addBuckets(request) {
             await axios.post( BASE_URL + '/api/v1/add_buckets', request)
         },
+        // addPairs takes the values as JSON text.
         async addPairs(request) {
-            await axios.post(BASE_URL + '/api/v1/add_pairs', request)
+            const pairs = request.Pairs.map((pair) => withRawJSON({key: pair.key}, 'value', pair.value))
+            const body = withRawJSON({level_stack: request.level_stack}, 'Pairs', '[' + pairs.join(',') + ']')
+            await axios.post(BASE_URL + '/api/v1/add_pairs', body, jsonHeaders)
         },
         async renameKey(request) {
             await axios.post(BASE_URL + '/api/v1/rename_key', request)
         },
+        // updateValue takes new_value as JSON text.
         async updateValue(request) {
-            await axios.post(BASE_URL + '/api/v1/update_value', request)
+            const {new_value, ...rest} = request
+            await axios.post(BASE_URL + '/api/v1/update_value', withRawJSON(rest, 'new_value', new_value), jsonHeaders)
         },
         async deleteEntry(request) {
             await axios.post(BASE_URL + '/api/v1/delete', request)
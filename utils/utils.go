@@ -1,8 +1,40 @@
 package utils
 
-import "strconv"
+import (
+	"path"
+	"strconv"
+	"strings"
+)
 
 func ParseInt(param string) int64 {
 	i, _ := strconv.ParseInt(param, 10, 64)
 	return i
 }
+
+// MatchLevelStack reports whether a level stack matches a bucket path
+// pattern such as "tenants/*/orders". Segments are separated by "/" and
+// matched with path.Match, and a "**" segment matches any number of levels.
+func MatchLevelStack(pattern string, levelStack []string) bool {
+	return matchSegments(strings.Split(pattern, "/"), levelStack)
+}
+
+func matchSegments(pattern, levelStack []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(levelStack); i++ {
+				if matchSegments(pattern[1:], levelStack[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(levelStack) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], levelStack[0]); !ok {
+			return false
+		}
+		pattern, levelStack = pattern[1:], levelStack[1:]
+	}
+	return len(levelStack) == 0
+}
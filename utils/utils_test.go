@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestMatchLevelStack(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		levelStack []string
+		want       bool
+	}{
+		{pattern: "users", levelStack: []string{"users"}, want: true},
+		{pattern: "users", levelStack: []string{"users", "1"}, want: false},
+		{pattern: "users", levelStack: []string{}, want: false},
+		{pattern: "tenants/*/orders", levelStack: []string{"tenants", "acme", "orders"}, want: true},
+		{pattern: "tenants/*/orders", levelStack: []string{"tenants", "orders"}, want: false},
+		{pattern: "tenants/*/orders", levelStack: []string{"tenants", "acme", "orders", "2024"}, want: false},
+		{pattern: "logs-??", levelStack: []string{"logs-01"}, want: true},
+		{pattern: "logs-[0-9]*", levelStack: []string{"logs-x"}, want: false},
+		{pattern: "**", levelStack: []string{}, want: true},
+		{pattern: "**", levelStack: []string{"a", "b", "c"}, want: true},
+		{pattern: "**/orders", levelStack: []string{"orders"}, want: true},
+		{pattern: "**/orders", levelStack: []string{"tenants", "acme", "orders"}, want: true},
+		{pattern: "**/orders", levelStack: []string{"tenants", "orders", "2024"}, want: false},
+		{pattern: "tenants/**", levelStack: []string{"tenants"}, want: true},
+		{pattern: "tenants/**/items", levelStack: []string{"tenants", "a", "b", "items"}, want: true},
+		{pattern: "tenants/**/items", levelStack: []string{"users", "items"}, want: false},
+		{pattern: "[", levelStack: []string{"["}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := MatchLevelStack(tt.pattern, tt.levelStack); got != tt.want {
+				t.Errorf("MatchLevelStack(%q, %q) = %v, want %v", tt.pattern, tt.levelStack, got, tt.want)
+			}
+		})
+	}
+}